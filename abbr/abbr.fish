@@ -4,6 +4,15 @@ if not set -q pal_prefix
     set -g pal_prefix pal
 end
 
+# Let pal /doctor know the abbreviations are loaded, with which prefix and
+# expansions file
+if test -n "$XDG_DATA_HOME"
+    set -gx PAL_ABBR_FILE "$XDG_DATA_HOME/pal_helper/expansions.txt"
+else
+    set -gx PAL_ABBR_FILE "$HOME/.config/pal_helper/expansions.txt"
+end
+set -gx PAL_ABBR_PREFIX $pal_prefix
+
 function _pal_get_completion
     # Use XDG_DATA_HOME or fallback to ~/.config
     set -l config_dir
@@ -0,0 +1,309 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	anthropicOption "github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/scottyeager/pal/config"
+)
+
+func init() {
+	RegisterBackend("anthropic", newAnthropicBackend)
+}
+
+type anthropicBackend struct {
+	client  *anthropic.Client
+	baseURL string
+}
+
+func newAnthropicBackend(providerName string, provider config.Provider) (Backend, error) {
+	httpClient, err := NewHTTPClient(providerName, provider.Network)
+	if err != nil {
+		return nil, err
+	}
+	opts := []anthropicOption.RequestOption{
+		anthropicOption.WithHTTPClient(httpClient),
+		anthropicOption.WithBaseURL(modelURL(provider.URL, "")),
+		// Retries are handled by the client, across all backends
+		anthropicOption.WithMaxRetries(0),
+		// The SDK picks up keys from the environment by default, but only
+		// the configured key should be sent
+		anthropicOption.WithHeaderDel("X-Api-Key"),
+		anthropicOption.WithHeaderDel("Authorization"),
+	}
+	if name, value := authHeader(provider, config.AuthXAPIKey); name != "" {
+		opts = append(opts, anthropicOption.WithHeader(name, value))
+	}
+	for name, value := range provider.Headers {
+		opts = append(opts, anthropicOption.WithHeader(name, value))
+	}
+	for key, value := range provider.QueryParams {
+		opts = append(opts, anthropicOption.WithQuery(key, value))
+	}
+	return &anthropicBackend{
+		client:  anthropic.NewClient(opts...),
+		baseURL: provider.URL,
+	}, nil
+}
+
+func (b *anthropicBackend) params(req Request) anthropic.MessageNewParams {
+	var messages []anthropic.MessageParam
+	for i, message := range req.Messages {
+		switch message.Role {
+		case "tool":
+			// Results of all the tool calls in a turn go in a single user
+			// message
+			block := anthropic.NewToolResultBlock(message.ToolCallID, message.Content, false)
+			if i > 0 && req.Messages[i-1].Role == "tool" {
+				last := &messages[len(messages)-1]
+				last.Content = anthropic.F(append(last.Content.Value, anthropic.ContentBlockParamUnion(block)))
+			} else {
+				messages = append(messages, anthropic.NewUserMessage(block))
+			}
+		case "assistant":
+			var blocks []anthropic.ContentBlockParamUnion
+			if message.Content != "" || len(message.ToolCalls) == 0 {
+				blocks = append(blocks, anthropic.NewTextBlock(message.Content))
+			}
+			for _, call := range message.ToolCalls {
+				var input any = map[string]any{}
+				if call.Arguments != "" {
+					json.Unmarshal([]byte(call.Arguments), &input)
+				}
+				blocks = append(blocks, anthropic.NewToolUseBlockParam(call.ID, call.Name, input))
+			}
+			messages = append(messages, anthropic.NewAssistantMessage(blocks...))
+		default:
+			var blocks []anthropic.ContentBlockParamUnion
+			for _, attachment := range message.Attachments {
+				blocks = append(blocks, anthropicAttachment(attachment))
+			}
+			blocks = append(blocks, anthropic.NewTextBlock(message.Content))
+			messages = append(messages, anthropic.NewUserMessage(blocks...))
+		}
+	}
+
+	// The API requires max_tokens, and it has to leave room for the answer
+	// after thinking
+	maxTokens := req.MaxTokens
+	if maxTokens == 0 {
+		maxTokens = anthropicMaxTokens
+	}
+	if budget := b.thinkingBudget(req); budget > 0 && maxTokens <= budget {
+		maxTokens = budget + anthropicMaxTokens
+	}
+
+	params := anthropic.MessageNewParams{
+		Model:     anthropic.F(req.Model),
+		MaxTokens: anthropic.F(maxTokens),
+		System: anthropic.F([]anthropic.TextBlockParam{
+			anthropic.NewTextBlock(req.System),
+		}),
+		Messages: anthropic.F(messages),
+	}
+	// Sampling parameters can't be changed while thinking
+	p := req.Params
+	thinking := b.thinkingBudget(req) > 0
+	if !thinking && !p.Omits("temperature") {
+		params.Temperature = anthropic.F(req.Temperature)
+	}
+	if p.TopP != nil && !thinking && !p.Omits("top_p") {
+		params.TopP = anthropic.F(*p.TopP)
+	}
+	if len(p.Stop) > 0 && !p.Omits("stop") {
+		params.StopSequences = anthropic.F(p.Stop)
+	}
+	var tools []anthropic.ToolParam
+	for _, tool := range req.Tools {
+		tools = append(tools, anthropic.ToolParam{
+			Name:        anthropic.F(tool.Name),
+			Description: anthropic.F(tool.Description),
+			InputSchema: anthropic.F[interface{}](tool.Parameters),
+		})
+	}
+	if len(tools) > 0 {
+		params.Tools = anthropic.F(tools)
+	}
+	if req.Schema != nil {
+		// Anthropic has no JSON mode. Instead, the model is made to call a
+		// tool whose input is the JSON we want
+		params.Tools = anthropic.F([]anthropic.ToolParam{{
+			Name:        anthropic.F(req.Schema.Name),
+			Description: anthropic.F(req.Schema.Description),
+			InputSchema: anthropic.F[interface{}](req.Schema.Schema),
+		}})
+		params.ToolChoice = anthropic.F[anthropic.ToolChoiceUnionParam](anthropic.ToolChoiceToolParam{
+			Name: anthropic.F(req.Schema.Name),
+			Type: anthropic.F(anthropic.ToolChoiceToolTypeTool),
+		})
+	}
+	return params
+}
+
+// anthropicAttachment converts an attachment to an image or document block
+func anthropicAttachment(attachment Attachment) anthropic.ContentBlockParamUnion {
+	if attachment.IsImage() {
+		return anthropic.NewImageBlockBase64(attachment.MediaType, attachment.base64())
+	}
+	return anthropic.DocumentBlockParam{
+		Type: anthropic.F(anthropic.DocumentBlockParamTypeDocument),
+		Source: anthropic.F[anthropic.DocumentBlockParamSourceUnion](anthropic.Base64PDFSourceParam{
+			Type:      anthropic.F(anthropic.Base64PDFSourceTypeBase64),
+			MediaType: anthropic.F(anthropic.Base64PDFSourceMediaTypeApplicationPDF),
+			Data:      anthropic.F(attachment.base64()),
+		}),
+		Title: anthropic.F(attachment.Name),
+	}
+}
+
+// anthropicMaxTokens is used when no max_tokens is configured
+const anthropicMaxTokens = 8192
+
+// thinkingBudget returns the number of tokens the model may think for, or 0
+// if thinking is off. Thinking can't be combined with the forced tool call
+// used for structured output, so it's off for those requests. It's off with
+// tools too, since follow-ups would have to send the thinking blocks back
+// with their signatures
+func (b *anthropicBackend) thinkingBudget(req Request) int64 {
+	if req.Schema != nil || len(req.Tools) > 0 {
+		return 0
+	}
+	return req.Params.ThinkingBudget
+}
+
+// options returns the request options for the parts of the request this
+// version of the SDK doesn't know about, and the URL for the model when it has
+// the model in it
+func (b *anthropicBackend) options(req Request) []anthropicOption.RequestOption {
+	var opts []anthropicOption.RequestOption
+	if strings.Contains(b.baseURL, "{model}") {
+		opts = append(opts, anthropicOption.WithBaseURL(modelURL(b.baseURL, req.Model)))
+	}
+	if budget := b.thinkingBudget(req); budget > 0 {
+		opts = append(opts, anthropicOption.WithJSONSet("thinking", map[string]any{
+			"type":          "enabled",
+			"budget_tokens": budget,
+		}))
+	}
+	for key, value := range req.Params.ExtraBody {
+		opts = append(opts, anthropicOption.WithJSONSet(key, value))
+	}
+	return opts
+}
+
+// ListModels returns the models listed by Anthropic's models endpoint
+func (b *anthropicBackend) ListModels(ctx context.Context) ([]string, error) {
+	var models []string
+	iter := b.client.Models.ListAutoPaging(ctx, anthropic.ModelListParams{Limit: anthropic.F(int64(1000))})
+	for iter.Next() {
+		models = append(models, iter.Current().ID)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list models from anthropic: %w", err)
+	}
+	return models, nil
+}
+
+func (b *anthropicBackend) Complete(ctx context.Context, req Request) (*Response, error) {
+	message, err := b.client.Messages.New(ctx, b.params(req), b.options(req)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get completion from anthropic: %w", err)
+	}
+
+	// Extract text content from message. This version of the SDK doesn't know
+	// about thinking blocks, and would parse them as empty text blocks, so
+	// check the type first
+	var completion, reasoning string
+	var toolCalls []ToolCall
+	for _, block := range message.Content {
+		if block.Type == "thinking" {
+			reasoning += anthropicThinking(block.JSON.RawJSON())
+			continue
+		}
+		switch block := block.AsUnion().(type) {
+		case anthropic.TextBlock:
+			completion += block.Text
+		case anthropic.ToolUseBlock:
+			if req.Schema != nil && block.Name == req.Schema.Name {
+				// Structured output, see params
+				completion += string(block.Input)
+			} else {
+				toolCalls = append(toolCalls, ToolCall{ID: block.ID, Name: block.Name, Arguments: string(block.Input)})
+			}
+		}
+	}
+	return &Response{Text: completion, Reasoning: reasoning, ToolCalls: toolCalls, Usage: anthropicUsage(message.Usage)}, nil
+}
+
+func (b *anthropicBackend) Stream(ctx context.Context, req Request, onDelta func(Delta)) (*Response, error) {
+	var completion, reasoning string
+	var usage Usage
+	// Tool calls by the index of their content block. Their input arrives in
+	// pieces, like text
+	var toolCalls []ToolCall
+	toolBlocks := map[int64]int{}
+	stream := b.client.Messages.NewStreaming(ctx, b.params(req), b.options(req)...)
+	for stream.Next() {
+		switch event := stream.Current().AsUnion().(type) {
+		case anthropic.MessageStartEvent:
+			usage = anthropicUsage(event.Message.Usage)
+		case anthropic.MessageDeltaEvent:
+			// Output tokens are counted up as the message is generated
+			usage.OutputTokens = event.Usage.OutputTokens
+		case anthropic.ContentBlockStartEvent:
+			block := event.ContentBlock
+			if block.Type == "tool_use" && (req.Schema == nil || block.Name != req.Schema.Name) {
+				toolBlocks[event.Index] = len(toolCalls)
+				toolCalls = append(toolCalls, ToolCall{ID: block.ID, Name: block.Name})
+			}
+		case anthropic.ContentBlockDeltaEvent:
+			if i, ok := toolBlocks[event.Index]; ok {
+				toolCalls[i].Arguments += event.Delta.PartialJSON
+				continue
+			}
+			if event.Delta.Type == "thinking_delta" {
+				thinking := anthropicThinking(event.Delta.JSON.RawJSON())
+				reasoning += thinking
+				onDelta(Delta{Reasoning: thinking})
+				continue
+			}
+			var text string
+			switch delta := event.Delta.AsUnion().(type) {
+			case anthropic.TextDelta:
+				text = delta.Text
+			case anthropic.InputJSONDelta:
+				text = delta.PartialJSON
+			}
+			if text != "" {
+				completion += text
+				onDelta(Delta{Text: text})
+			}
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get completion from anthropic: %w", err)
+	}
+	return &Response{Text: completion, Reasoning: reasoning, ToolCalls: toolCalls, Usage: usage}, nil
+}
+
+// anthropicThinking gets the text out of a thinking block or delta
+func anthropicThinking(raw string) string {
+	var thinking struct {
+		Thinking string `json:"thinking"`
+	}
+	json.Unmarshal([]byte(raw), &thinking)
+	return thinking.Thinking
+}
+
+// Anthropic counts cached input separately, so add it back in
+func anthropicUsage(usage anthropic.Usage) Usage {
+	return Usage{
+		InputTokens:  usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens,
+		OutputTokens: usage.OutputTokens,
+		CachedTokens: usage.CacheReadInputTokens,
+	}
+}
@@ -0,0 +1,43 @@
+package ai
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/scottyeager/pal/config"
+)
+
+func TestAnthropicThinkingWithTools(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "msg", "type": "message", "role": "assistant", "content": [{"type": "text", "text": "hi"}], "stop_reason": "end_turn", "usage": {"input_tokens": 1, "output_tokens": 1}}`))
+	}))
+	defer server.Close()
+
+	backend, err := newAnthropicBackend("anthropic", config.Provider{URL: server.URL, APIKey: "key"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := Request{Model: "claude", Messages: userPrompt("hello"), MaxTokens: 8000, Params: config.Params{ThinkingBudget: 2000}}
+	if _, err := backend.Complete(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+	req.Tools = []ToolDef{{Name: "read_file", Parameters: map[string]any{"type": "object"}}}
+	if _, err := backend.Complete(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(bodies[0], `"thinking"`) {
+		t.Errorf("thinking not turned on without tools: %s", bodies[0])
+	}
+	if strings.Contains(bodies[1], `"thinking"`) {
+		t.Errorf("thinking turned on with tools: %s", bodies[1])
+	}
+}
@@ -0,0 +1,126 @@
+package ai
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/scottyeager/pal/config"
+)
+
+// apiKeyCmdTimeout limits how long api_key_cmd may take. Password managers
+// can ask for a passphrase, so it's generous
+const apiKeyCmdTimeout = 2 * time.Minute
+
+var (
+	resolvedKeysMu sync.Mutex
+	// Keys from api_key_cmd, by provider name, so the command runs only once
+	// even when the provider serves several models
+	resolvedKeys = map[string]*resolvedKey{}
+)
+
+// resolvedKey holds a provider's key from api_key_cmd. Its lock is held
+// while the command runs, so other providers' commands don't wait on it
+type resolvedKey struct {
+	mu  sync.Mutex
+	key string
+}
+
+// providerKey returns the provider's entry in resolvedKeys, adding it if
+// it's not there yet
+func providerKey(providerName string) *resolvedKey {
+	resolvedKeysMu.Lock()
+	defer resolvedKeysMu.Unlock()
+	entry, ok := resolvedKeys[providerName]
+	if !ok {
+		entry = &resolvedKey{}
+		resolvedKeys[providerName] = entry
+	}
+	return entry
+}
+
+// APIKeyError is returned by Ping when the API key can't be had from where
+// the config says it is
+type APIKeyError struct {
+	Err error
+}
+
+func (e *APIKeyError) Error() string { return e.Err.Error() }
+func (e *APIKeyError) Unwrap() error { return e.Err }
+
+// resolveAPIKey returns the provider with its API key filled in from
+// api_key_env, api_key_file or api_key_cmd, when it uses one of them. The
+// command is stopped when ctx is done
+func resolveAPIKey(ctx context.Context, providerName string, provider config.Provider) (config.Provider, error) {
+	switch {
+	case provider.APIKeyEnv != "":
+		key := os.Getenv(provider.APIKeyEnv)
+		if key == "" {
+			return provider, fmt.Errorf("Provider %s takes its API key from $%s, which isn't set", providerName, provider.APIKeyEnv)
+		}
+		provider.APIKey = key
+
+	case provider.APIKeyFile != "":
+		path, err := configPath(expandHome(provider.APIKeyFile))
+		if err != nil {
+			return provider, err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return provider, fmt.Errorf("failed to read the API key for %s: %w", providerName, err)
+		}
+		if config.WorldReadable(path) {
+			fmt.Fprintf(os.Stderr, "Warning: the API key file for %s can be read by other users. Run 'chmod 600 %s'\n", providerName, path)
+		}
+		provider.APIKey = strings.TrimSpace(string(data))
+		if provider.APIKey == "" {
+			return provider, fmt.Errorf("The API key file for %s is empty: %s", providerName, path)
+		}
+
+	case provider.APIKeyCmd != "":
+		entry := providerKey(providerName)
+		entry.mu.Lock()
+		defer entry.mu.Unlock()
+		if entry.key != "" {
+			provider.APIKey = entry.key
+			return provider, nil
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, apiKeyCmdTimeout)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", provider.APIKeyCmd)
+		// Programs started by the shell outlive it when it's killed, and
+		// would keep its output open
+		cmd.WaitDelay = time.Second
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return provider, fmt.Errorf("api_key_cmd for %s failed: %w\n%s", providerName, err, strings.TrimSpace(stderr.String()))
+		}
+		// Like pass, many password managers print more lines after the
+		// password itself
+		key, _, _ := strings.Cut(string(out), "\n")
+		provider.APIKey = strings.TrimSpace(key)
+		if provider.APIKey == "" {
+			return provider, fmt.Errorf("api_key_cmd for %s printed nothing", providerName)
+		}
+		entry.key = provider.APIKey
+	}
+	return provider, nil
+}
+
+// expandHome replaces a leading ~/ with the home directory
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return home + "/" + rest
+		}
+	}
+	return path
+}
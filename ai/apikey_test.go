@@ -0,0 +1,107 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/scottyeager/pal/config"
+)
+
+func TestResolveAPIKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PAL_TEST_KEY", "from-env")
+
+	tests := []struct {
+		name     string
+		provider config.Provider
+		want     string
+	}{
+		{"plain", config.Provider{APIKey: "plain"}, "plain"},
+		{"env", config.Provider{APIKeyEnv: "PAL_TEST_KEY"}, "from-env"},
+		{"file", config.Provider{APIKeyFile: keyFile}, "from-file"},
+		{"cmd", config.Provider{APIKeyCmd: "printf 'from-cmd\\nuser: me\\n'"}, "from-cmd"},
+	}
+	for _, tt := range tests {
+		provider, err := resolveAPIKey(context.Background(), tt.name, tt.provider)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if provider.APIKey != tt.want {
+			t.Errorf("%s: got key %q, want %q", tt.name, provider.APIKey, tt.want)
+		}
+	}
+
+	if _, err := resolveAPIKey(context.Background(), "unset", config.Provider{APIKeyEnv: "PAL_TEST_UNSET"}); err == nil {
+		t.Errorf("unset environment variable accepted")
+	}
+	if _, err := resolveAPIKey(context.Background(), "failing", config.Provider{APIKeyCmd: "exit 1"}); err == nil {
+		t.Errorf("failing command accepted")
+	}
+}
+
+func TestResolveAPIKeyCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// A hanging command for one provider doesn't hold up the others
+	done := make(chan error)
+	go func() {
+		_, err := resolveAPIKey(ctx, "hanging", config.Provider{APIKeyCmd: "sleep 10"})
+		done <- err
+	}()
+	if _, err := resolveAPIKey(context.Background(), "quick", config.Provider{APIKeyCmd: "echo quick"}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Errorf("cancelled command accepted")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("api_key_cmd kept running after the context was done")
+	}
+}
+
+func TestClientResolvesKeysWhenUsed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "hi"}}]}`))
+	}))
+	defer server.Close()
+
+	marker := filepath.Join(t.TempDir(), "ran")
+	cfg := &config.Config{Providers: map[string]config.Provider{
+		"broken":   {URL: server.URL, APIKeyCmd: "exit 1"},
+		"primary":  {URL: server.URL, APIKey: "key"},
+		"fallback": {URL: server.URL, APIKeyCmd: "touch " + marker + "; echo key"},
+	}}
+
+	client, err := NewClient(cfg, "primary/model", "fallback/model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetJSON(context.Background(), "", "hello", 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("api_key_cmd ran for a fallback model that wasn't needed")
+	}
+
+	// A key that can't be had is a failure like any other, so the fallback
+	// model answers instead
+	client, err = NewClient(cfg, "broken/model", "primary/model")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.GetJSON(context.Background(), "", "hello", 0, nil); err != nil {
+		t.Errorf("fallback not used when the key couldn't be had: %v", err)
+	}
+}
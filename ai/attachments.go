@@ -0,0 +1,114 @@
+package ai
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Attachment is an image or PDF sent along with a user message
+type Attachment struct {
+	Name string `json:"name"`
+	// Where the file was read from
+	Path      string `json:"path,omitempty"`
+	MediaType string `json:"media_type"`
+	// Encoded as base64 in JSON, which is also what the APIs want. Sessions
+	// are saved without it, so attachments are only sent with the question
+	// they were attached to
+	Data []byte `json:"data,omitempty"`
+}
+
+// Providers limit the size of requests, and nothing larger than this gets
+// through any of them
+const maxAttachmentSize = 20 * 1024 * 1024
+
+var attachmentTypes = []string{"image/png", "image/jpeg", "image/gif", "image/webp", "application/pdf"}
+
+// LoadAttachment reads an image or PDF file. The type is detected from the
+// contents, so the file's extension doesn't matter
+func LoadAttachment(path string) (Attachment, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("failed to read attachment: %w", err)
+	}
+	if len(data) > maxAttachmentSize {
+		return Attachment{}, fmt.Errorf("%s is too large to attach. The limit is %d MB", path, maxAttachmentSize/1024/1024)
+	}
+
+	mediaType := http.DetectContentType(data)
+	if !slices.Contains(attachmentTypes, mediaType) {
+		return Attachment{}, fmt.Errorf("%s isn't an image or PDF (detected %s). Supported are PNG, JPEG, GIF, WebP and PDF", path, mediaType)
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	return Attachment{Name: filepath.Base(path), Path: path, MediaType: mediaType, Data: data}, nil
+}
+
+func (a Attachment) IsImage() bool {
+	return a.MediaType != "application/pdf"
+}
+
+func (a Attachment) base64() string {
+	return base64.StdEncoding.EncodeToString(a.Data)
+}
+
+// dataURL encodes the attachment the way OpenAI compatible APIs take it
+func (a Attachment) dataURL() string {
+	return "data:" + a.MediaType + ";base64," + a.base64()
+}
+
+func hasAttachments(messages []Message) bool {
+	for _, message := range messages {
+		if len(message.Attachments) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// WithoutAttachmentData returns a copy of messages with the data of their
+// attachments left out, for saving them
+func WithoutAttachmentData(messages []Message) []Message {
+	messages = slices.Clone(messages)
+	for i, message := range messages {
+		if len(message.Attachments) == 0 {
+			continue
+		}
+		message.Attachments = slices.Clone(message.Attachments)
+		for j := range message.Attachments {
+			message.Attachments[j].Data = nil
+		}
+		messages[i] = message
+	}
+	return messages
+}
+
+// withoutEarlierAttachments replaces the attachments that have no data, those
+// of earlier questions in a saved session, with a note in their message. The
+// model has already seen them and answered about them
+func withoutEarlierAttachments(messages []Message) []Message {
+	messages = slices.Clone(messages)
+	for i, message := range messages {
+		var kept []Attachment
+		var earlier []string
+		for _, attachment := range message.Attachments {
+			if len(attachment.Data) > 0 {
+				kept = append(kept, attachment)
+			} else {
+				earlier = append(earlier, attachment.Name)
+			}
+		}
+		if len(earlier) == 0 {
+			continue
+		}
+		message.Attachments = kept
+		message.Content = fmt.Sprintf("[attached earlier: %s]\n%s", strings.Join(earlier, ", "), message.Content)
+		messages[i] = message
+	}
+	return messages
+}
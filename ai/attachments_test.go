@@ -0,0 +1,73 @@
+package ai
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAttachment(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name      string
+		contents  string
+		mediaType string
+	}{
+		// Named to show that the extension is ignored
+		{"screenshot.dat", "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR", "image/png"},
+		{"datasheet", "%PDF-1.7\n", "application/pdf"},
+		{"notes.png", "just some text", ""},
+	}
+
+	for _, tt := range tests {
+		path := filepath.Join(dir, tt.name)
+		if err := os.WriteFile(path, []byte(tt.contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		attachment, err := LoadAttachment(path)
+		if tt.mediaType == "" {
+			if err == nil {
+				t.Errorf("LoadAttachment(%s) accepted a text file", tt.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("LoadAttachment(%s) failed: %v", tt.name, err)
+			continue
+		}
+		if attachment.MediaType != tt.mediaType || attachment.Name != tt.name || attachment.Path != path {
+			t.Errorf("LoadAttachment(%s) = %s %s, want %s", tt.name, attachment.Name, attachment.MediaType, tt.mediaType)
+		}
+	}
+}
+
+func TestEarlierAttachments(t *testing.T) {
+	png := Attachment{Name: "error.png", MediaType: "image/png", Data: []byte("png")}
+	pdf := Attachment{Name: "datasheet.pdf", MediaType: "application/pdf", Data: []byte("pdf")}
+	messages := []Message{
+		{Role: "user", Content: "what's this?", Attachments: []Attachment{png}},
+		{Role: "assistant", Content: "An error dialog"},
+	}
+
+	// Saving drops the data, without touching the messages being used
+	saved := WithoutAttachmentData(messages)
+	if len(saved[0].Attachments) != 1 || saved[0].Attachments[0].Data != nil || saved[0].Attachments[0].Name != "error.png" {
+		t.Errorf("saved attachments = %+v", saved[0].Attachments)
+	}
+	if messages[0].Attachments[0].Data == nil {
+		t.Error("data dropped from the original messages")
+	}
+
+	// Continuing the session only sends the new attachment
+	saved = append(saved, Message{Role: "user", Content: "and this?", Attachments: []Attachment{pdf}})
+	sent := withoutEarlierAttachments(saved)
+	if len(sent[0].Attachments) != 0 || sent[0].Content != "[attached earlier: error.png]\nwhat's this?" {
+		t.Errorf("earlier question sent as %+v", sent[0])
+	}
+	if len(sent[2].Attachments) != 1 || sent[2].Content != "and this?" {
+		t.Errorf("new question sent as %+v", sent[2])
+	}
+	if len(saved[0].Attachments) != 1 {
+		t.Error("attachments dropped from the session's messages")
+	}
+}
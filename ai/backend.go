@@ -0,0 +1,191 @@
+package ai
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/scottyeager/pal/config"
+)
+
+// Request holds everything a backend needs to produce a completion,
+// independent of the provider's API
+type Request struct {
+	// The command key the request is made for, like "cmd" or "ask"
+	Command     string
+	Model       string
+	System      string
+	Messages    []Message
+	Temperature float64
+	// MaxTokens of 0 leaves the limit to the provider, where the API allows
+	MaxTokens int64
+	// Params are the provider's generation parameters for the model
+	Params config.Params
+	// Schema asks for a JSON response, for backends that support structured
+	// output. Others rely on the prompt asking for JSON.
+	Schema *Schema
+	// Tools the model may call instead of answering right away
+	Tools []ToolDef
+}
+
+// Schema describes the JSON a response should contain
+type Schema struct {
+	Name        string
+	Description string
+	// A JSON schema. For the widest support, all properties should be
+	// required and additionalProperties should be false
+	Schema map[string]any
+}
+
+type Response struct {
+	Text string
+	// Reasoning is the model's thinking, for models that return it separately
+	// from the answer
+	Reasoning string
+	// Tools the model wants called before it continues
+	ToolCalls []ToolCall
+	Usage     Usage
+}
+
+// Delta is a piece of a streamed response. Only one of the fields is set
+type Delta struct {
+	Text      string
+	Reasoning string
+}
+
+// Usage counts the tokens of a request. InputTokens includes CachedTokens,
+// which were read from the provider's prompt cache
+type Usage struct {
+	InputTokens  int64
+	OutputTokens int64
+	CachedTokens int64
+}
+
+// Backend is implemented once for each provider API. Which backend serves a
+// provider is decided by the provider's type in the config.
+type Backend interface {
+	Complete(ctx context.Context, req Request) (*Response, error)
+	// Stream is like Complete, but onDelta is called with each piece of text
+	// as it arrives. The returned response holds the full text.
+	Stream(ctx context.Context, req Request, onDelta func(Delta)) (*Response, error)
+}
+
+// ModelLister is implemented by backends that can ask the provider which
+// models are available
+type ModelLister interface {
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// ListModels asks the provider which models it has. Not all provider types
+// support this
+func ListModels(ctx context.Context, providerName string, provider config.Provider) ([]string, error) {
+	provider, err := resolveAPIKey(ctx, providerName, provider)
+	if err != nil {
+		return nil, err
+	}
+	backend, err := newBackend(providerName, provider)
+	if err != nil {
+		return nil, err
+	}
+	lister, ok := backend.(ModelLister)
+	if !ok {
+		return nil, fmt.Errorf("listing models isn't supported for providers of type %s", ProviderType(providerName, provider))
+	}
+	return lister.ListModels(ctx)
+}
+
+// Ping sends a tiny request straight to a model, without retries, fallbacks
+// or the cache, to check that the provider can be reached and takes the API
+// key. It returns how long the request took
+func Ping(ctx context.Context, cfg *config.Config, providerName string, model string) (time.Duration, error) {
+	provider, err := resolveAPIKey(ctx, providerName, cfg.Providers[providerName])
+	if err != nil {
+		return 0, &APIKeyError{err}
+	}
+	provider.Network = provider.Network.Or(cfg.Network)
+	backend, err := newBackend(providerName, provider)
+	if err != nil {
+		return 0, err
+	}
+
+	req := Request{
+		Command:  "doctor",
+		Model:    model,
+		Messages: userPrompt("Reply with just OK"),
+		Params:   provider.ParamsFor(model),
+	}
+	req.MaxTokens = req.Params.MaxTokens
+	start := time.Now()
+	_, err = backend.Complete(ctx, req)
+	return time.Since(start), err
+}
+
+// CanListModels reports whether the provider's type supports ListModels
+func CanListModels(providerName string, provider config.Provider) bool {
+	backend, err := newBackend(providerName, provider)
+	if err != nil {
+		// Let ListModels report the error
+		return true
+	}
+	_, ok := backend.(ModelLister)
+	return ok
+}
+
+// BackendFactory creates a backend for the named provider
+type BackendFactory func(providerName string, provider config.Provider) (Backend, error)
+
+var backends = map[string]BackendFactory{}
+
+// RegisterBackend makes a backend available for providers of the given type.
+// Backends register themselves from init functions.
+func RegisterBackend(providerType string, factory BackendFactory) {
+	backends[providerType] = factory
+}
+
+// BackendTypes returns the registered provider types, sorted
+func BackendTypes() []string {
+	types := make([]string, 0, len(backends))
+	for t := range backends {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// ProviderType returns the type of the provider. Configs written before the
+// type field existed don't have one, so fall back on what was hard coded
+// back then: "anthropic" used its own SDK and everything else was assumed to
+// be OpenAI compatible.
+func ProviderType(providerName string, provider config.Provider) string {
+	if provider.Type != "" {
+		return provider.Type
+	}
+	if providerName == "anthropic" {
+		return "anthropic"
+	}
+	return "openai"
+}
+
+func newBackend(providerName string, provider config.Provider) (Backend, error) {
+	providerType := ProviderType(providerName, provider)
+	factory, ok := backends[providerType]
+	if !ok {
+		return nil, fmt.Errorf("Provider %s has unknown type '%s'. Supported types are: %v", providerName, providerType, BackendTypes())
+	}
+	return factory(providerName, provider)
+}
+
+// configPath resolves a path from the config. Relative paths are relative to
+// the config directory
+func configPath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, path), nil
+}
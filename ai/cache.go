@@ -0,0 +1,155 @@
+package ai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/scottyeager/pal/config"
+	"github.com/scottyeager/pal/inout"
+)
+
+// NoCache bypasses the response cache, even if it's enabled in the config
+var NoCache bool
+
+const cacheDirName = "cache"
+
+type cacheEntry struct {
+	Created time.Time `json:"created"`
+	Model   string    `json:"model"`
+	Text    string    `json:"text"`
+}
+
+// responseCache stores responses on disk, keyed by everything that goes into
+// the request
+type responseCache struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+}
+
+// newResponseCache returns nil if caching is disabled
+func newResponseCache(cfg config.Cache) *responseCache {
+	if !cfg.Enabled || NoCache {
+		return nil
+	}
+	basePath, err := config.GetBasePath()
+	if err != nil {
+		return nil
+	}
+
+	cache := &responseCache{
+		dir:     filepath.Join(basePath, cacheDirName),
+		ttl:     cfg.TTL,
+		maxSize: cfg.MaxSize,
+	}
+	if cache.ttl <= 0 {
+		cache.ttl = config.DefaultCacheTTL
+	}
+	if cache.maxSize <= 0 {
+		cache.maxSize = config.DefaultCacheMaxSize
+	}
+	return cache
+}
+
+func cacheKey(t *target, req Request) string {
+	data, _ := json.Marshal(struct {
+		Provider string
+		Request  Request
+	}{t.providerName, req})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheable reports whether the response to req would be the same next time
+func cacheable(req Request) bool {
+	// A response with tool calls depends on more than its text
+	return req.Temperature == 0 && len(req.Tools) == 0
+}
+
+func (c *responseCache) get(key string) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	path := filepath.Join(c.dir, key+".json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || time.Since(entry.Created) > c.ttl {
+		os.Remove(path)
+		return "", false
+	}
+	return entry.Text, true
+}
+
+// put stores a response. The cache is only an optimization, so errors are
+// ignored
+func (c *responseCache) put(key string, model string, text string) {
+	if c == nil {
+		return
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return
+	}
+
+	data, err := json.Marshal(cacheEntry{
+		Created: time.Now(),
+		Model:   model,
+		Text:    text,
+	})
+	if err != nil {
+		return
+	}
+	if err := inout.WriteFileAtomic(filepath.Join(c.dir, key+".json"), data, 0600); err != nil {
+		return
+	}
+	c.prune()
+}
+
+// prune removes expired entries, then the oldest ones until the cache fits
+// within its size limit
+func (c *responseCache) prune() {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return
+	}
+
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	var total int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(c.dir, entry.Name())
+		if time.Since(info.ModTime()) > c.ttl {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, file{path, info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+	for _, f := range files {
+		if total <= c.maxSize {
+			break
+		}
+		os.Remove(f.path)
+		total -= f.size
+	}
+}
@@ -4,117 +4,139 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"os"
 	"strings"
+	"time"
 
-	"github.com/charmbracelet/glamour"
-
-	anthropic "github.com/anthropics/anthropic-sdk-go"
-	anthropicOption "github.com/anthropics/anthropic-sdk-go/option"
-	openai "github.com/openai/openai-go/v3"
-	openaiOption "github.com/openai/openai-go/v3/option"
 	"github.com/scottyeager/pal/config"
 	"github.com/scottyeager/pal/inout"
 )
 
+// Message is one turn of a conversation. Role is either "user" or
+// "assistant", or "tool" for the result of a tool call
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+	// Set on assistant messages that call tools
+	ToolCalls []ToolCall `json:"tool_calls,omitempty"`
+	// Set on tool messages, to match the result to its call
+	ToolCallID string `json:"tool_call_id,omitempty"`
+	ToolName   string `json:"tool_name,omitempty"`
+	// Images and PDFs sent with a user message
+	Attachments []Attachment `json:"attachments,omitempty"`
+}
+
+// Timeout overrides the configured time limit for getting a response, when
+// it's set
+var Timeout time.Duration
+
 type Client struct {
-	openaiClient    openai.Client
-	anthropicClient *anthropic.Client
-	provider        config.Provider
-	model           string
-	providerName    string
-}
-
-func NewClient(cfg *config.Config, modelName string) (*Client, error) {
-	parts := strings.SplitN(modelName, "/", 2)
-	if len(parts) < 2 {
-		return nil, fmt.Errorf("Model name %s isn't valid. Please use /models or /model to select a valid model.", modelName)
-	}
-	providerName, model := parts[0], parts[1]
-	provider := cfg.Providers[providerName]
-
-	var openaiClient openai.Client
-	var anthropicClient *anthropic.Client
-
-	switch providerName {
-	case "anthropic":
-		anthropicClient = anthropic.NewClient(
-			anthropicOption.WithAPIKey(provider.APIKey),
-			anthropicOption.WithBaseURL(provider.URL),
-		)
-	default:
-		openaiClient = openai.NewClient(
-			openaiOption.WithAPIKey(provider.APIKey),
-			openaiOption.WithBaseURL(provider.URL),
-		)
-	}
-
-	return &Client{
-		openaiClient:    openaiClient,
-		anthropicClient: anthropicClient,
-		provider:        provider,
-		model:           model,
-		providerName:    providerName,
-	}, nil
+	// The selected model comes first, followed by any fallback models
+	targets []*target
+	retry   config.Retry
+	cache   *responseCache
+	timeout time.Duration
+	// The command key, recorded in the usage ledger
+	key string
+	// Tokens used by all of the client's requests so far
+	usage Usage
 }
 
-func (c *Client) GetCompletion(ctx context.Context, system_prompt string, prompt string, storeCommands bool, temperature float64, formatMarkdown bool, model string) (string, error) {
-	var completion string
-	var err error
+// target is one model the client can send requests to
+type target struct {
+	// Set by connect, the first time the target is used
+	backend      Backend
+	provider     config.Provider
+	model        string
+	providerName string
+}
 
-	if c.providerName == "anthropic" {
-		message, err := c.anthropicClient.Messages.New(ctx, anthropic.MessageNewParams{
-			Model:     anthropic.F(c.model),
-			MaxTokens: anthropic.F(int64(4096)),
-			System: anthropic.F([]anthropic.TextBlockParam{
-				anthropic.NewTextBlock(system_prompt),
-			}),
-			Messages: anthropic.F([]anthropic.MessageParam{
-				anthropic.NewUserMessage(anthropic.NewTextBlock(prompt)),
-			}),
-			Temperature: anthropic.F(temperature),
-		})
-		if err != nil {
-			return "", fmt.Errorf("failed to get completion from anthropic: %w", err)
-		}
+func (t *target) name() string {
+	return t.providerName + "/" + t.model
+}
 
-		// Extract text content from message
-		for _, block := range message.Content {
-			if textBlock, ok := block.AsUnion().(anthropic.TextBlock); ok {
-				completion += textBlock.Text
-			}
-		}
-	} else {
-		resp, err := c.openaiClient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
-			Messages: []openai.ChatCompletionMessageParamUnion{
-				openai.SystemMessage(system_prompt),
-				openai.UserMessage(prompt),
-			},
-			Model:       c.model,
-			Temperature: openai.Float(temperature),
-			MaxTokens:   openai.Int(4096),
-		})
+// connect resolves the target's API key and creates its backend, unless
+// that's been done already. Keys are resolved only for the targets that are
+// used, so an api_key_cmd doesn't run for fallback models that are never
+// needed, and can be interrupted through ctx
+func (t *target) connect(ctx context.Context) error {
+	if t.backend != nil {
+		return nil
+	}
+	provider, err := resolveAPIKey(ctx, t.providerName, t.provider)
+	if err != nil {
+		return err
+	}
+	backend, err := newBackend(t.providerName, provider)
+	if err != nil {
+		return err
+	}
+	t.provider, t.backend = provider, backend
+	return nil
+}
 
-		if err != nil {
-			var apierr *openai.Error
-			if errors.As(err, &apierr) {
-				return "", fmt.Errorf("failed to get completion from %s: %w\n%s\n", c.providerName, err, apierr.Response.Body)
-			}
-			return "", fmt.Errorf("failed to get completion from %s: %w", c.providerName, err)
+// NewClient creates a client for modelName. If requests to that model fail,
+// fallbackModels are tried in order.
+func NewClient(cfg *config.Config, modelName string, fallbackModels ...string) (*Client, error) {
+	client := &Client{
+		retry: cfg.Retry,
+		cache: newResponseCache(cfg.Cache),
+	}
+	for _, name := range append([]string{modelName}, fallbackModels...) {
+		parts := strings.SplitN(name, "/", 2)
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("Model name %s isn't valid. Please use /models or /model to select a valid model.", name)
 		}
+		providerName, model := parts[0], parts[1]
+		provider := cfg.Providers[providerName]
+		provider.Network = provider.Network.Or(cfg.Network)
 
-		if len(resp.Choices) == 0 {
-			return "", fmt.Errorf("no command choices returned")
-		}
+		client.targets = append(client.targets, &target{
+			provider:     provider,
+			model:        model,
+			providerName: providerName,
+		})
+	}
+	return client, nil
+}
 
-		completion = resp.Choices[0].Message.Content
+// NewCommandClient creates a client using the selected model and fallback
+// models for the command key
+func NewCommandClient(cfg *config.Config, key string) (*Client, error) {
+	client, err := NewClient(cfg, config.GetSelectedModel(cfg, key), config.GetFallbackModels(cfg, key)...)
+	if err != nil {
+		return nil, err
 	}
+	client.key = key
+	client.timeout = config.GetTimeout(cfg, key)
+	return client, nil
+}
 
-	// Remove <tool_call> block if present
-	if thinkStart := strings.Index(completion, "<tool_call>"); thinkStart != -1 {
-		if thinkEnd := strings.Index(completion[thinkStart:], "</tool_call>"); thinkEnd != -1 {
-			completion = completion[:thinkStart] + strings.TrimSpace(completion[thinkStart+thinkEnd+len("</tool_call>"):])
-		}
+// NewModelClient creates a client for modelName alone, without fallback
+// models, but otherwise set up for the command key
+func NewModelClient(cfg *config.Config, key string, modelName string) (*Client, error) {
+	client, err := NewClient(cfg, modelName)
+	if err != nil {
+		return nil, err
 	}
+	client.key = key
+	client.timeout = config.GetTimeout(cfg, key)
+	return client, nil
+}
+
+// Usage returns the tokens used by the client's requests so far
+func (c *Client) Usage() Usage {
+	return c.usage
+}
+
+func (c *Client) GetCompletion(ctx context.Context, system_prompt string, prompt string, storeCommands bool, temperature float64, formatMarkdown bool, model string) (string, error) {
+	resp, err := c.complete(ctx, Request{System: system_prompt, Messages: userPrompt(prompt), Temperature: temperature}, nil)
+	if err != nil {
+		return "", err
+	}
+
+	completion := stripToolCall(resp.Text)
 
 	if storeCommands {
 		// Store the completion
@@ -125,35 +147,238 @@ func (c *Client) GetCompletion(ctx context.Context, system_prompt string, prompt
 	}
 
 	if formatMarkdown {
-		r, _ := glamour.NewTermRenderer(
-			glamour.WithAutoStyle(),
-			glamour.WithWordWrap(80),
-		)
-		formatted, err := r.Render(completion)
+		formatted, err := renderMarkdown(completion)
 		if err != nil {
 			return completion, nil
 		}
+		return formatted, nil
+	}
+	return completion, nil
+}
+
+// StreamCompletion works like GetCompletion, but onDelta is called with each
+// piece of text as it arrives from the provider. The full completion is
+// returned once the stream ends, so callers that need the complete text (to
+// sanitize it or write it to disk) can still have it. Formatting is left to
+// the caller, usually through a StreamPrinter.
+func (c *Client) StreamCompletion(ctx context.Context, system_prompt string, prompt string, temperature float64, onDelta func(string)) (string, error) {
+	return c.StreamChat(ctx, system_prompt, userPrompt(prompt), temperature, onDelta)
+}
+
+// StreamChat is like StreamCompletion, but takes a whole conversation. The
+// last message should be from the user.
+func (c *Client) StreamChat(ctx context.Context, system_prompt string, messages []Message, temperature float64, onDelta func(string)) (string, error) {
+	if onDelta == nil {
+		onDelta = func(string) {}
+	}
+	resp, err := c.complete(ctx, Request{System: system_prompt, Messages: messages, Temperature: temperature}, onDelta)
+	if err != nil {
+		return "", err
+	}
+	return stripToolCall(resp.Text), nil
+}
+
+// GetJSON requests a response in JSON matching schema. Backends that support
+// structured output are asked to enforce the schema. Not every provider does,
+// even among those with compatible APIs, so the prompt should ask for the JSON
+// too and the caller should be ready for a response that doesn't match.
+func (c *Client) GetJSON(ctx context.Context, system_prompt string, prompt string, temperature float64, schema *Schema) (string, error) {
+	resp, err := c.complete(ctx, Request{System: system_prompt, Messages: userPrompt(prompt), Temperature: temperature, Schema: schema}, nil)
+	if err != nil {
+		return "", err
+	}
+	return stripToolCall(resp.Text), nil
+}
+
+func userPrompt(prompt string) []Message {
+	return []Message{{Role: "user", Content: prompt}}
+}
+
+// complete requests a completion, trying each model in turn until one
+// succeeds. The model is filled in for each one. If onDelta is not nil, the
+// streaming endpoint is used and onDelta receives each text delta. Reasoning
+// is removed from the returned text.
+func (c *Client) complete(ctx context.Context, base Request, onDelta func(string)) (*Response, error) {
+	base.Messages = withoutEarlierAttachments(base.Messages)
+
+	// api_key_cmd may wait for a passphrase, which shouldn't count toward
+	// the time limit for the response
+	keyCtx := ctx
+	timeout := c.timeout
+	if Timeout > 0 {
+		timeout = Timeout
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Once some text has been streamed to the user, we can't take it back.
+	// So at that point failures are final
+	streamed := false
+	if onDelta != nil {
+		deltaFunc := onDelta
+		onDelta = func(delta string) {
+			streamed = true
+			deltaFunc(delta)
+		}
+	}
+
+	var err error
+	for i, t := range c.targets {
+		if hasAttachments(base.Messages) && !t.provider.SupportsVision(t.model) {
+			err = fmt.Errorf("%s isn't marked as vision capable, so it can't take attachments. If it accepts images and PDFs, add it to the provider's vision list in config.yaml", t.name())
+			continue
+		}
+
+		req := base
+		req.Command = c.key
+		req.Model = t.model
+		req.Params = t.provider.ParamsFor(t.model)
+		if req.MaxTokens == 0 {
+			req.MaxTokens = req.Params.MaxTokens
+		}
 
-		// Remove the two space margin included in Glamour's default styles
-		// Since there's color codes included before the actual spaces, we need
-		// to remove what's before the spaces too. Yeah, it would be cleaner to
-		// actually ship updated styles, but this is easy and seems to work
-		lines := strings.Split(formatted, "\n")
-		for i, line := range lines {
-			parts := strings.SplitN(line, "  ", 2)
-			if len(parts) > 1 {
-				lines[i] = parts[1]
+		key := cacheKey(t, req)
+		if cacheable(req) {
+			if text, ok := c.cache.get(key); ok {
+				if onDelta != nil {
+					onDelta(text)
+				}
+				return &Response{Text: text}, nil
+			}
+		}
+
+		if err = t.connect(keyCtx); err != nil {
+			if keyCtx.Err() != nil {
+				return nil, err
+			}
+			c.reportFallback(i, err)
+			continue
+		}
+
+		var resp *Response
+		attempt := func() error {
+			attemptCtx := ctx
+			if t.provider.Timeout > 0 {
+				var cancel context.CancelFunc
+				attemptCtx, cancel = context.WithTimeout(ctx, t.provider.Timeout)
+				defer cancel()
+			}
+
+			var err error
+			if onDelta != nil {
+				resp, err = c.stream(attemptCtx, t, req, onDelta)
 			} else {
-				lines[i] = parts[0]
+				resp, err = t.backend.Complete(attemptCtx, req)
+				if err == nil {
+					_, inline := splitThinking(resp.Text)
+					printer := newReasoningPrinter()
+					printer.print(resp.Reasoning)
+					printer.print(inline)
+					printer.finish()
+				}
+			}
+			if err != nil && streamed {
+				return noRetry{err}
 			}
+			return err
 		}
-		formatted = strings.Join(lines, "\n")
+		err = withRetries(ctx, c.retry, t.name(), attempt)
 
-		// Also trim one newline from the end, again to adjust default style
-		if strings.HasSuffix(formatted, "\n") {
-			formatted = formatted[:len(formatted)-1]
+		// Providers that don't support structured output reject the request.
+		// The prompt asks for JSON anyway, so try again without the schema
+		if err != nil && req.Schema != nil && !streamed && StatusCode(err) == http.StatusBadRequest {
+			req.Schema = nil
+			err = withRetries(ctx, c.retry, t.name(), attempt)
 		}
-		return formatted, nil
+
+		if err == nil {
+			if i > 0 {
+				fmt.Fprintf(os.Stderr, "Answered by fallback model %s\n", t.name())
+			}
+			c.recordUsage(t, resp.Usage)
+			c.usage.InputTokens += resp.Usage.InputTokens
+			c.usage.OutputTokens += resp.Usage.OutputTokens
+			c.usage.CachedTokens += resp.Usage.CachedTokens
+			// Reasoning is never part of the answer, so it can't end up in
+			// the expansions file or written to disk
+			resp.Text, _ = splitThinking(resp.Text)
+			if cacheable(req) {
+				c.cache.put(key, t.name(), resp.Text)
+			}
+			return resp, nil
+		}
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("no response within %s: %w", timeout, err)
+		}
+		if streamed || ctx.Err() != nil {
+			return nil, err
+		}
+		c.reportFallback(i, err)
 	}
-	return completion, nil
+	return nil, err
+}
+
+// reportFallback tells the user that the target at i failed, when there's
+// another one to fall back to
+func (c *Client) reportFallback(i int, err error) {
+	if i < len(c.targets)-1 {
+		fmt.Fprintf(os.Stderr, "Model %s failed: %v\nFalling back to %s\n", c.targets[i].name(), SummarizeError(err), c.targets[i+1].name())
+	}
+}
+
+// stream streams a response from t, passing the answer to onDelta. Reasoning
+// is split off, whether the backend returns it separately or inline in
+// <think> tags, and only shown if ShowThinking is set.
+func (c *Client) stream(ctx context.Context, t *target, req Request, onDelta func(string)) (*Response, error) {
+	splitter := &thinkSplitter{}
+	printer := newReasoningPrinter()
+	handle := func(answer string, reasoning string) {
+		printer.print(reasoning)
+		if answer != "" {
+			printer.finish()
+			onDelta(answer)
+		}
+	}
+
+	resp, err := t.backend.Stream(ctx, req, func(delta Delta) {
+		printer.print(delta.Reasoning)
+		handle(splitter.write(delta.Text))
+	})
+	if err == nil {
+		handle(splitter.flush())
+	}
+	printer.finish()
+	return resp, err
+}
+
+// recordUsage appends the request to the usage ledger. Failing to do so
+// shouldn't fail the command, so errors are only reported
+func (c *Client) recordUsage(t *target, usage Usage) {
+	price := t.provider.Prices[t.model]
+	record := inout.UsageRecord{
+		Timestamp:    time.Now(),
+		Command:      c.key,
+		Model:        t.name(),
+		InputTokens:  usage.InputTokens,
+		OutputTokens: usage.OutputTokens,
+		CachedTokens: usage.CachedTokens,
+		Cost:         price.Cost(usage.InputTokens, usage.OutputTokens, usage.CachedTokens),
+	}
+	if err := inout.AppendUsage(record); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+	}
+}
+
+// Remove <tool_call> block if present
+func stripToolCall(completion string) string {
+	if thinkStart := strings.Index(completion, "<tool_call>"); thinkStart != -1 {
+		if thinkEnd := strings.Index(completion[thinkStart:], "</tool_call>"); thinkEnd != -1 {
+			completion = completion[:thinkStart] + strings.TrimSpace(completion[thinkStart+thinkEnd+len("</tool_call>"):])
+		}
+	}
+	return completion
 }
@@ -0,0 +1,98 @@
+package ai
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/scottyeager/pal/config"
+)
+
+// authHeader returns the header that carries the provider's API key, going
+// by its auth style, or defaultStyle when it has none. The name is empty when
+// no key should be sent
+func authHeader(provider config.Provider, defaultStyle string) (name string, value string) {
+	style := provider.AuthStyle
+	if style == "" {
+		style = defaultStyle
+	}
+	switch style {
+	case config.AuthBearer:
+		return "Authorization", "Bearer " + provider.APIKey
+	case config.AuthAPIKey:
+		return "Api-Key", provider.APIKey
+	case config.AuthXAPIKey:
+		return "X-Api-Key", provider.APIKey
+	}
+	return "", ""
+}
+
+// modelURL fills the model into a provider URL with a {model} placeholder
+func modelURL(url string, model string) string {
+	return strings.ReplaceAll(url, "{model}", model)
+}
+
+// NewHTTPClient returns an HTTP client using the proxy and TLS settings. name
+// says what the client is for, in errors and warnings. Without any settings,
+// it's the default client, which uses the proxy from the environment
+func NewHTTPClient(name string, network config.Network) (*http.Client, error) {
+	if network == (config.Network{}) {
+		return http.DefaultClient, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if network.Proxy != "" {
+		proxy, err := url.Parse(network.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, fmt.Errorf("proxy for %s isn't a valid URL like http://proxy.example.com:3128: %s", name, network.Proxy)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	tlsConfig := &tls.Config{}
+	if network.CAFile != "" {
+		path, err := configPath(network.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ca_file for %s: %w", name, err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ca_file for %s has no PEM certificates: %s", name, path)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if network.ClientCert != "" {
+		certPath, err := configPath(network.ClientCert)
+		if err != nil {
+			return nil, err
+		}
+		keyPath := certPath
+		if network.ClientKey != "" {
+			if keyPath, err = configPath(network.ClientKey); err != nil {
+				return nil, err
+			}
+		}
+		cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client_cert for %s: %w", name, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if network.InsecureSkipVerify {
+		fmt.Fprintf(os.Stderr, "WARNING: TLS certificate verification is turned off for %s. Anyone between you and the server can read and change the traffic, including your API key. Use ca_file instead of insecure_skip_verify if you can\n", name)
+		tlsConfig.InsecureSkipVerify = true
+	}
+	transport.TLSClientConfig = tlsConfig
+	return &http.Client{Transport: transport}, nil
+}
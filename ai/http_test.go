@@ -0,0 +1,75 @@
+package ai
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/scottyeager/pal/config"
+)
+
+func TestNewHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// Without the CA, the server's certificate isn't trusted
+	client, err := NewHTTPClient("test", config.Network{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Errorf("untrusted certificate accepted")
+	}
+
+	// HTTPS requests through the proxy start with a CONNECT to the server
+	var connected []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			connected = append(connected, r.Host)
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer proxy.Close()
+	client, err = NewHTTPClient("test", config.Network{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Get(server.URL)
+	if want := strings.TrimPrefix(server.URL, "https://"); len(connected) != 1 || connected[0] != want {
+		t.Errorf("proxy got CONNECT requests for %v, want one for %s", connected, want)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, ca, 0644); err != nil {
+		t.Fatal(err)
+	}
+	client, err = NewHTTPClient("test", config.Network{CAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("request with ca_file failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if _, err := NewHTTPClient("test", config.Network{CAFile: filepath.Join(t.TempDir(), "missing.pem")}); err == nil {
+		t.Errorf("missing ca_file accepted")
+	}
+	if _, err := NewHTTPClient("test", config.Network{Proxy: "not a url"}); err == nil {
+		t.Errorf("invalid proxy accepted")
+	}
+}
+
+func TestNetworkOr(t *testing.T) {
+	defaults := config.Network{Proxy: "http://proxy:3128", CAFile: "corp.pem"}
+	got := config.Network{CAFile: "other.pem"}.Or(defaults)
+	if got.Proxy != "http://proxy:3128" || got.CAFile != "other.pem" {
+		t.Errorf("unexpected network settings %+v", got)
+	}
+}
@@ -0,0 +1,39 @@
+package ai
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/glamour"
+)
+
+func renderMarkdown(completion string) (string, error) {
+	r, _ := glamour.NewTermRenderer(
+		glamour.WithAutoStyle(),
+		glamour.WithWordWrap(80),
+	)
+	formatted, err := r.Render(completion)
+	if err != nil {
+		return "", err
+	}
+
+	// Remove the two space margin included in Glamour's default styles
+	// Since there's color codes included before the actual spaces, we need
+	// to remove what's before the spaces too. Yeah, it would be cleaner to
+	// actually ship updated styles, but this is easy and seems to work
+	lines := strings.Split(formatted, "\n")
+	for i, line := range lines {
+		parts := strings.SplitN(line, "  ", 2)
+		if len(parts) > 1 {
+			lines[i] = parts[1]
+		} else {
+			lines[i] = parts[0]
+		}
+	}
+	formatted = strings.Join(lines, "\n")
+
+	// Also trim one newline from the end, again to adjust default style
+	if strings.HasSuffix(formatted, "\n") {
+		formatted = formatted[:len(formatted)-1]
+	}
+	return formatted, nil
+}
@@ -0,0 +1,206 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/scottyeager/pal/config"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	RegisterBackend("mock", newMockBackend)
+}
+
+// mockBackend answers from a file of canned responses instead of calling an
+// API, so pal can be scripted and tested offline. Every request is recorded
+type mockBackend struct {
+	providerName string
+	fixtures     string
+	record       string
+}
+
+// mockFixture is one canned response. The first fixture that matches a
+// request answers it
+type mockFixture struct {
+	// The command key, like "cmd" or "ask". Empty matches any command
+	Command string `yaml:"command" json:"command"`
+	// The model name, without the provider. Empty matches any model
+	Model string `yaml:"model" json:"model"`
+	// A regular expression matched against the last user message. Empty
+	// matches any prompt
+	Prompt   string `yaml:"prompt" json:"prompt"`
+	Response string `yaml:"response" json:"response"`
+	// Fail the request with this HTTP status instead, for example to try out
+	// retries and fallback models
+	Status int `yaml:"status" json:"status"`
+}
+
+// mockRecord is what gets recorded of each request, one JSON object per line
+type mockRecord struct {
+	Time        time.Time `json:"time"`
+	Command     string    `json:"command"`
+	Model       string    `json:"model"`
+	Stream      bool      `json:"stream"`
+	System      string    `json:"system"`
+	Messages    []Message `json:"messages"`
+	Temperature float64   `json:"temperature"`
+	Schema      string    `json:"schema,omitempty"`
+	Tools       []string  `json:"tools,omitempty"`
+}
+
+func newMockBackend(providerName string, provider config.Provider) (Backend, error) {
+	if provider.Fixtures == "" {
+		return nil, fmt.Errorf("mock provider %s has no fixtures file configured", providerName)
+	}
+	record := provider.Record
+	if record == "" {
+		record = "mock_requests.jsonl"
+	}
+
+	fixtures, err := configPath(provider.Fixtures)
+	if err != nil {
+		return nil, err
+	}
+	record, err = configPath(record)
+	if err != nil {
+		return nil, err
+	}
+	return &mockBackend{providerName: providerName, fixtures: fixtures, record: record}, nil
+}
+
+func (b *mockBackend) Complete(ctx context.Context, req Request) (*Response, error) {
+	return b.respond(req, false)
+}
+
+func (b *mockBackend) Stream(ctx context.Context, req Request, onDelta func(Delta)) (*Response, error) {
+	resp, err := b.respond(req, true)
+	if err != nil {
+		return nil, err
+	}
+	// Send the response a word at a time, like a real stream
+	for _, word := range strings.SplitAfter(resp.Text, " ") {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		onDelta(Delta{Text: word})
+	}
+	return resp, nil
+}
+
+func (b *mockBackend) respond(req Request, stream bool) (*Response, error) {
+	if err := b.save(req, stream); err != nil {
+		return nil, fmt.Errorf("failed to record mock request: %w", err)
+	}
+
+	fixtures, err := loadMockFixtures(b.fixtures)
+	if err != nil {
+		return nil, err
+	}
+	prompt := lastUserMessage(req.Messages)
+	for _, fixture := range fixtures {
+		if fixture.Command != "" && fixture.Command != req.Command {
+			continue
+		}
+		if fixture.Model != "" && fixture.Model != req.Model {
+			continue
+		}
+		if fixture.Prompt != "" {
+			matched, err := regexp.MatchString(fixture.Prompt, prompt)
+			if err != nil {
+				return nil, fmt.Errorf("invalid prompt pattern in %s: %w", b.fixtures, err)
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		if fixture.Status != 0 {
+			return nil, &HTTPError{StatusCode: fixture.Status, Body: "mock error"}
+		}
+		return &Response{Text: fixture.Response}, nil
+	}
+	return nil, fmt.Errorf("no mock response in %s matches this %s request", b.fixtures, req.Command)
+}
+
+// save appends the request to the record file
+func (b *mockBackend) save(req Request, stream bool) error {
+	record := mockRecord{
+		Time:        time.Now(),
+		Command:     req.Command,
+		Model:       req.Model,
+		Stream:      stream,
+		System:      req.System,
+		Messages:    req.Messages,
+		Temperature: req.Temperature,
+	}
+	if req.Schema != nil {
+		record.Schema = req.Schema.Name
+	}
+	for _, tool := range req.Tools {
+		record.Tools = append(record.Tools, tool.Name)
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(b.record), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(b.record, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// loadMockFixtures reads fixtures from a YAML list, or from JSON lines when
+// the file name ends in .jsonl
+func loadMockFixtures(path string) ([]mockFixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mock fixtures: %w", err)
+	}
+
+	var fixtures []mockFixture
+	if strings.HasSuffix(path, ".jsonl") {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(nil, 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var fixture mockFixture
+			if err := json.Unmarshal(scanner.Bytes(), &fixture); err != nil {
+				return nil, fmt.Errorf("invalid mock fixture on line %d of %s: %w", line, path, err)
+			}
+			fixtures = append(fixtures, fixture)
+		}
+		return fixtures, scanner.Err()
+	}
+
+	if err := yaml.Unmarshal(data, &fixtures); err != nil {
+		return nil, fmt.Errorf("invalid mock fixtures in %s: %w", path, err)
+	}
+	return fixtures, nil
+}
+
+func lastUserMessage(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == "user" {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
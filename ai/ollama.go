@@ -0,0 +1,352 @@
+package ai
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/scottyeager/pal/config"
+)
+
+func init() {
+	RegisterBackend("ollama", newOllamaBackend)
+}
+
+// ollamaBackend talks to Ollama's native API, which exposes options like the
+// context size that aren't available through its OpenAI compatible API
+type ollamaBackend struct {
+	httpClient   *http.Client
+	baseURL      string
+	provider     config.Provider
+	providerName string
+}
+
+func newOllamaBackend(providerName string, provider config.Provider) (Backend, error) {
+	baseURL := provider.URL
+	if baseURL == "" {
+		baseURL = config.ProviderTemplates["ollama"].URL
+	}
+	httpClient, err := NewHTTPClient(providerName, provider.Network)
+	if err != nil {
+		return nil, err
+	}
+	return &ollamaBackend{
+		httpClient:   httpClient,
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		provider:     provider,
+		providerName: providerName,
+	}, nil
+}
+
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+	// Encoded as base64, like Ollama expects
+	Images [][]byte `json:"images,omitempty"`
+}
+
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+type ollamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
+}
+
+type ollamaChatRequest struct {
+	Model     string          `json:"model"`
+	Messages  []ollamaMessage `json:"messages"`
+	Stream    bool            `json:"stream"`
+	Options   map[string]any  `json:"options,omitempty"`
+	KeepAlive string          `json:"keep_alive,omitempty"`
+	// Either "json" or a JSON schema
+	Format any          `json:"format,omitempty"`
+	Tools  []ollamaTool `json:"tools,omitempty"`
+	// Models like gpt-oss take a reasoning effort here
+	Think string `json:"think,omitempty"`
+}
+
+type ollamaChatResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	PromptEvalCount int64         `json:"prompt_eval_count"`
+	EvalCount       int64         `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+func (b *ollamaBackend) chatRequest(req Request, stream bool) (any, error) {
+	messages := []ollamaMessage{{Role: "system", Content: req.System}}
+	for _, message := range req.Messages {
+		m := ollamaMessage{Role: message.Role, Content: message.Content, ToolName: message.ToolName}
+		for _, attachment := range message.Attachments {
+			if !attachment.IsImage() {
+				return nil, fmt.Errorf("Ollama doesn't accept PDFs, only images")
+			}
+			m.Images = append(m.Images, attachment.Data)
+		}
+		for _, call := range message.ToolCalls {
+			var toolCall ollamaToolCall
+			toolCall.Function.Name = call.Name
+			toolCall.Function.Arguments = json.RawMessage(call.Arguments)
+			if !json.Valid(toolCall.Function.Arguments) {
+				toolCall.Function.Arguments = json.RawMessage("{}")
+			}
+			m.ToolCalls = append(m.ToolCalls, toolCall)
+		}
+		messages = append(messages, m)
+	}
+
+	// Options from the config, like num_ctx, come first so that the request's
+	// own settings take precedence
+	options := map[string]any{}
+	for key, value := range b.provider.Options {
+		options[key] = value
+	}
+	p := req.Params
+	if !p.Omits("temperature") {
+		options["temperature"] = req.Temperature
+	}
+	if req.MaxTokens > 0 && !p.Omits("max_tokens") {
+		options["num_predict"] = req.MaxTokens
+	}
+	if p.TopP != nil && !p.Omits("top_p") {
+		options["top_p"] = *p.TopP
+	}
+	if len(p.Stop) > 0 && !p.Omits("stop") {
+		options["stop"] = p.Stop
+	}
+
+	chat := ollamaChatRequest{
+		Model:     req.Model,
+		Messages:  messages,
+		Stream:    stream,
+		Options:   options,
+		KeepAlive: b.provider.KeepAlive,
+		Think:     p.ReasoningEffort,
+	}
+	if req.Schema != nil {
+		chat.Format = req.Schema.Schema
+	}
+	for _, tool := range req.Tools {
+		t := ollamaTool{Type: "function"}
+		t.Function.Name = tool.Name
+		t.Function.Description = tool.Description
+		t.Function.Parameters = tool.Parameters
+		chat.Tools = append(chat.Tools, t)
+	}
+	if len(p.ExtraBody) == 0 {
+		return chat, nil
+	}
+
+	// Extra fields from the config go on top of the request
+	data, err := json.Marshal(chat)
+	if err != nil {
+		return nil, err
+	}
+	body := map[string]any{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, err
+	}
+	for key, value := range p.ExtraBody {
+		body[key] = value
+	}
+	return body, nil
+}
+
+// ollamaToolCalls converts tool calls from Ollama, which doesn't give them IDs
+func ollamaToolCalls(calls []ollamaToolCall, offset int) []ToolCall {
+	var toolCalls []ToolCall
+	for i, call := range calls {
+		toolCalls = append(toolCalls, ToolCall{
+			ID:        fmt.Sprintf("call_%d", offset+i),
+			Name:      call.Function.Name,
+			Arguments: string(call.Function.Arguments),
+		})
+	}
+	return toolCalls
+}
+
+func (b *ollamaBackend) post(ctx context.Context, path string, body any) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, b.baseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	return b.do(httpReq)
+}
+
+func (b *ollamaBackend) do(httpReq *http.Request) (*http.Response, error) {
+	// Ollama itself has no authentication, but it's often put behind a proxy
+	// that does
+	if name, value := authHeader(b.provider, config.AuthBearer); name != "" && b.provider.APIKey != "" {
+		httpReq.Header.Set(name, value)
+	}
+	for name, value := range b.provider.Headers {
+		httpReq.Header.Set(name, value)
+	}
+	if len(b.provider.QueryParams) > 0 {
+		query := httpReq.URL.Query()
+		for key, value := range b.provider.QueryParams {
+			query.Set(key, value)
+		}
+		httpReq.URL.RawQuery = query.Encode()
+	}
+	resp, err := b.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, newHTTPError(resp)
+	}
+	return resp, nil
+}
+
+func (b *ollamaBackend) Complete(ctx context.Context, req Request) (*Response, error) {
+	body, err := b.chatRequest(req, false)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.post(ctx, "/api/chat", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get completion from %s: %w", b.providerName, err)
+	}
+	defer resp.Body.Close()
+
+	var chat ollamaChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&chat); err != nil {
+		return nil, fmt.Errorf("failed to parse response from %s: %w", b.providerName, err)
+	}
+	if chat.Error != "" {
+		return nil, fmt.Errorf("failed to get completion from %s: %s", b.providerName, chat.Error)
+	}
+
+	return &Response{
+		Text:      chat.Message.Content,
+		Reasoning: chat.Message.Thinking,
+		ToolCalls: ollamaToolCalls(chat.Message.ToolCalls, 0),
+		Usage: Usage{
+			InputTokens:  chat.PromptEvalCount,
+			OutputTokens: chat.EvalCount,
+		},
+	}, nil
+}
+
+func (b *ollamaBackend) Stream(ctx context.Context, req Request, onDelta func(Delta)) (*Response, error) {
+	body, err := b.chatRequest(req, true)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.post(ctx, "/api/chat", body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get completion from %s: %w", b.providerName, err)
+	}
+	defer resp.Body.Close()
+
+	// The response is a series of JSON objects, one per line
+	var completion, reasoning string
+	var toolCalls []ToolCall
+	var usage Usage
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var chunk ollamaChatResponse
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return nil, fmt.Errorf("failed to parse response from %s: %w", b.providerName, err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("failed to get completion from %s: %s", b.providerName, chunk.Error)
+		}
+		if thinking := chunk.Message.Thinking; thinking != "" {
+			reasoning += thinking
+			onDelta(Delta{Reasoning: thinking})
+		}
+		if delta := chunk.Message.Content; delta != "" {
+			completion += delta
+			onDelta(Delta{Text: delta})
+		}
+		toolCalls = append(toolCalls, ollamaToolCalls(chunk.Message.ToolCalls, len(toolCalls))...)
+		if chunk.Done {
+			usage = Usage{
+				InputTokens:  chunk.PromptEvalCount,
+				OutputTokens: chunk.EvalCount,
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get completion from %s: %w", b.providerName, err)
+	}
+	return &Response{Text: completion, Reasoning: reasoning, ToolCalls: toolCalls, Usage: usage}, nil
+}
+
+// ListModels returns the models that are installed in Ollama
+func (b *ollamaBackend) ListModels(ctx context.Context) ([]string, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, b.baseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := b.do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list models from %s: %w", b.providerName, err)
+	}
+	defer resp.Body.Close()
+
+	var tags struct {
+		Models []struct {
+			Name string `json:"name"`
+		} `json:"models"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tags); err != nil {
+		return nil, fmt.Errorf("failed to parse model list from %s: %w", b.providerName, err)
+	}
+
+	var models []string
+	for _, model := range tags.Models {
+		models = append(models, model.Name)
+	}
+	return models, nil
+}
+
+// HTTPError is returned by backends that make their own HTTP requests, when
+// the response has an error status
+type HTTPError struct {
+	StatusCode int
+	Response   *http.Response
+	Body       string
+}
+
+func newHTTPError(resp *http.Response) *HTTPError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return &HTTPError{
+		StatusCode: resp.StatusCode,
+		Response:   resp,
+		Body:       strings.TrimSpace(string(body)),
+	}
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Body)
+}
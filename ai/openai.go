@@ -0,0 +1,341 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	openai "github.com/openai/openai-go/v3"
+	openaiOption "github.com/openai/openai-go/v3/option"
+	"github.com/openai/openai-go/v3/packages/respjson"
+	"github.com/openai/openai-go/v3/shared"
+	"github.com/scottyeager/pal/config"
+)
+
+func init() {
+	RegisterBackend("openai", newOpenAIBackend)
+}
+
+// openaiBackend serves OpenAI and any provider with a compatible API
+type openaiBackend struct {
+	client       openai.Client
+	providerName string
+	baseURL      string
+}
+
+func newOpenAIBackend(providerName string, provider config.Provider) (Backend, error) {
+	httpClient, err := NewHTTPClient(providerName, provider.Network)
+	if err != nil {
+		return nil, err
+	}
+	opts := []openaiOption.RequestOption{
+		openaiOption.WithHTTPClient(httpClient),
+		openaiOption.WithBaseURL(modelURL(provider.URL, "")),
+		// Retries are handled by the client, across all backends
+		openaiOption.WithMaxRetries(0),
+		// The SDK picks up OPENAI_API_KEY by default, but only the configured
+		// key should be sent
+		openaiOption.WithHeaderDel("Authorization"),
+	}
+	if name, value := authHeader(provider, config.AuthBearer); name != "" {
+		opts = append(opts, openaiOption.WithHeader(name, value))
+	}
+	for name, value := range provider.Headers {
+		opts = append(opts, openaiOption.WithHeader(name, value))
+	}
+	for key, value := range provider.QueryParams {
+		opts = append(opts, openaiOption.WithQuery(key, value))
+	}
+	return &openaiBackend{
+		client:       openai.NewClient(opts...),
+		providerName: providerName,
+		baseURL:      provider.URL,
+	}, nil
+}
+
+func (b *openaiBackend) params(req Request) openai.ChatCompletionNewParams {
+	messages := []openai.ChatCompletionMessageParamUnion{
+		openai.SystemMessage(req.System),
+	}
+	for _, message := range req.Messages {
+		switch {
+		case message.Role == "tool":
+			messages = append(messages, openai.ToolMessage(message.Content, message.ToolCallID))
+		case message.Role == "assistant" && len(message.ToolCalls) > 0:
+			assistant := openai.ChatCompletionAssistantMessageParam{}
+			if message.Content != "" {
+				assistant.Content.OfString = openai.String(message.Content)
+			}
+			for _, call := range message.ToolCalls {
+				assistant.ToolCalls = append(assistant.ToolCalls, openai.ChatCompletionMessageToolCallUnionParam{
+					OfFunction: &openai.ChatCompletionMessageFunctionToolCallParam{
+						ID: call.ID,
+						Function: openai.ChatCompletionMessageFunctionToolCallFunctionParam{
+							Name:      call.Name,
+							Arguments: call.Arguments,
+						},
+					},
+				})
+			}
+			messages = append(messages, openai.ChatCompletionMessageParamUnion{OfAssistant: &assistant})
+		case message.Role == "assistant":
+			messages = append(messages, openai.AssistantMessage(message.Content))
+		case len(message.Attachments) > 0:
+			messages = append(messages, openai.UserMessage(openaiContentParts(message)))
+		default:
+			messages = append(messages, openai.UserMessage(message.Content))
+		}
+	}
+
+	params := openai.ChatCompletionNewParams{
+		Messages: messages,
+		Model:    req.Model,
+	}
+
+	// Reasoning models reject sampling parameters and the old max_tokens
+	reasoning := openaiReasoningModel(req.Model)
+	p := req.Params
+	if !reasoning && !p.Omits("temperature") {
+		params.Temperature = openai.Float(req.Temperature)
+	}
+	if req.MaxTokens > 0 && !p.Omits("max_tokens") {
+		if reasoning {
+			params.MaxCompletionTokens = openai.Int(req.MaxTokens)
+		} else {
+			params.MaxTokens = openai.Int(req.MaxTokens)
+		}
+	}
+	if p.TopP != nil && !reasoning && !p.Omits("top_p") {
+		params.TopP = openai.Float(*p.TopP)
+	}
+	if len(p.Stop) > 0 && !reasoning && !p.Omits("stop") {
+		params.Stop = openai.ChatCompletionNewParamsStopUnion{OfStringArray: p.Stop}
+	}
+	if p.ReasoningEffort != "" {
+		params.ReasoningEffort = shared.ReasoningEffort(p.ReasoningEffort)
+	}
+
+	if req.Schema != nil {
+		params.ResponseFormat = openai.ChatCompletionNewParamsResponseFormatUnion{
+			OfJSONSchema: &shared.ResponseFormatJSONSchemaParam{
+				JSONSchema: shared.ResponseFormatJSONSchemaJSONSchemaParam{
+					Name:        req.Schema.Name,
+					Description: openai.String(req.Schema.Description),
+					Schema:      req.Schema.Schema,
+					Strict:      openai.Bool(true),
+				},
+			},
+		}
+	}
+	for _, tool := range req.Tools {
+		params.Tools = append(params.Tools, openai.ChatCompletionFunctionTool(shared.FunctionDefinitionParam{
+			Name:        tool.Name,
+			Description: openai.String(tool.Description),
+			Parameters:  shared.FunctionParameters(tool.Parameters),
+		}))
+	}
+	return params
+}
+
+func (b *openaiBackend) Complete(ctx context.Context, req Request) (*Response, error) {
+	resp, err := b.client.Chat.Completions.New(ctx, b.params(req), b.options(req)...)
+	if err != nil {
+		return nil, b.error(err)
+	}
+
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no command choices returned")
+	}
+
+	message := resp.Choices[0].Message
+	var toolCalls []ToolCall
+	for _, call := range message.ToolCalls {
+		toolCalls = append(toolCalls, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: call.Function.Arguments})
+	}
+	return &Response{
+		Text:      message.Content,
+		Reasoning: openaiReasoning(message.JSON.ExtraFields),
+		ToolCalls: toolCalls,
+		Usage:     openaiUsage(resp.Usage),
+	}, nil
+}
+
+func (b *openaiBackend) Stream(ctx context.Context, req Request, onDelta func(Delta)) (*Response, error) {
+	params := b.params(req)
+	// Usage is sent in an extra chunk at the end, but only if requested
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{
+		IncludeUsage: openai.Bool(true),
+	}
+
+	var completion, reasoning string
+	var usage Usage
+	// Tool calls arrive in pieces, matched up by their index
+	var toolCalls []ToolCall
+	stream := b.client.Chat.Completions.NewStreaming(ctx, params, b.options(req)...)
+	for stream.Next() {
+		chunk := stream.Current()
+		if chunk.JSON.Usage.Valid() {
+			usage = openaiUsage(chunk.Usage)
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		delta := chunk.Choices[0].Delta
+		if thinking := openaiReasoning(delta.JSON.ExtraFields); thinking != "" {
+			reasoning += thinking
+			onDelta(Delta{Reasoning: thinking})
+		}
+		if delta.Content != "" {
+			completion += delta.Content
+			onDelta(Delta{Text: delta.Content})
+		}
+		for _, call := range delta.ToolCalls {
+			for int64(len(toolCalls)) <= call.Index {
+				toolCalls = append(toolCalls, ToolCall{})
+			}
+			toolCall := &toolCalls[call.Index]
+			if call.ID != "" {
+				toolCall.ID = call.ID
+			}
+			toolCall.Name += call.Function.Name
+			toolCall.Arguments += call.Function.Arguments
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return nil, b.error(err)
+	}
+	return &Response{Text: completion, Reasoning: reasoning, ToolCalls: toolCalls, Usage: usage}, nil
+}
+
+// ListModels returns the chat models listed by the provider's models
+// endpoint
+func (b *openaiBackend) ListModels(ctx context.Context) ([]string, error) {
+	if strings.Contains(b.baseURL, "{model}") {
+		return nil, fmt.Errorf("%s has the model in its URL, so there's no models endpoint to list them from", b.providerName)
+	}
+	var models []string
+	iter := b.client.Models.ListAutoPaging(ctx)
+	for iter.Next() {
+		if id := iter.Current().ID; openaiChatModel(id) {
+			models = append(models, id)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list models from %s: %w", b.providerName, err)
+	}
+	return models, nil
+}
+
+// openaiContentParts puts a message's attachments before its text
+func openaiContentParts(message Message) []openai.ChatCompletionContentPartUnionParam {
+	var parts []openai.ChatCompletionContentPartUnionParam
+	for _, attachment := range message.Attachments {
+		if attachment.IsImage() {
+			parts = append(parts, openai.ImageContentPart(openai.ChatCompletionContentPartImageImageURLParam{
+				URL: attachment.dataURL(),
+			}))
+		} else {
+			parts = append(parts, openai.FileContentPart(openai.ChatCompletionContentPartFileFileParam{
+				FileData: openai.String(attachment.dataURL()),
+				Filename: openai.String(attachment.Name),
+			}))
+		}
+	}
+	return append(parts, openai.TextContentPart(message.Content))
+}
+
+// openaiNonChatModels are parts of the names of models that the models
+// endpoint lists, but that can't be used for chat completions
+var openaiNonChatModels = []string{
+	"embed",
+	"whisper",
+	"tts",
+	"transcribe",
+	"dall-e",
+	"gpt-image",
+	"sora",
+	"moderation",
+	"realtime",
+	"audio",
+	"davinci",
+	"babbage",
+}
+
+// openaiChatModel reports whether model can be used for chat completions,
+// judging by its name
+func openaiChatModel(model string) bool {
+	model = strings.ToLower(model)
+	for _, part := range openaiNonChatModels {
+		if strings.Contains(model, part) {
+			return false
+		}
+	}
+	return true
+}
+
+// openaiReasoningModel reports whether model is one of OpenAI's reasoning
+// models, also when it's named with a vendor prefix like "openai/o3"
+func openaiReasoningModel(model string) bool {
+	model = strings.ToLower(model[strings.LastIndex(model, "/")+1:])
+	if strings.HasPrefix(model, "gpt-5") {
+		// The chat variants are regular models
+		return !strings.HasPrefix(model, "gpt-5-chat")
+	}
+	return len(model) > 1 && model[0] == 'o' && model[1] >= '1' && model[1] <= '9'
+}
+
+// options are the per request options: the URL for the model, when it has the
+// model in it, and the configured extra fields for the request body
+func (b *openaiBackend) options(req Request) []openaiOption.RequestOption {
+	opts := openaiExtraBody(req.Params)
+	if strings.Contains(b.baseURL, "{model}") {
+		opts = append(opts, openaiOption.WithBaseURL(modelURL(b.baseURL, req.Model)))
+	}
+	return opts
+}
+
+// openaiExtraBody adds the configured extra fields to the request body
+func openaiExtraBody(p config.Params) []openaiOption.RequestOption {
+	var opts []openaiOption.RequestOption
+	for key, value := range p.ExtraBody {
+		opts = append(opts, openaiOption.WithJSONSet(key, value))
+	}
+	return opts
+}
+
+// openaiReasoning returns the reasoning from a message or delta. It isn't part
+// of the OpenAI API, but compatible providers like DeepSeek add it as an extra
+// field. Which name is used varies by provider
+func openaiReasoning(fields map[string]respjson.Field) string {
+	for _, name := range []string{"reasoning_content", "reasoning"} {
+		// Extra fields are never marked valid, since there's no type to check
+		// them against, so just try to decode them
+		field, ok := fields[name]
+		if !ok {
+			continue
+		}
+		var reasoning string
+		if err := json.Unmarshal([]byte(field.Raw()), &reasoning); err == nil && reasoning != "" {
+			return reasoning
+		}
+	}
+	return ""
+}
+
+func openaiUsage(usage openai.CompletionUsage) Usage {
+	return Usage{
+		InputTokens:  usage.PromptTokens,
+		OutputTokens: usage.CompletionTokens,
+		CachedTokens: usage.PromptTokensDetails.CachedTokens,
+	}
+}
+
+func (b *openaiBackend) error(err error) error {
+	var apierr *openai.Error
+	if errors.As(err, &apierr) && apierr.Response != nil {
+		return fmt.Errorf("failed to get completion from %s: %w\n%s\n", b.providerName, err, apierr.Response.Body)
+	}
+	return fmt.Errorf("failed to get completion from %s: %w", b.providerName, err)
+}
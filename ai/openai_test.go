@@ -0,0 +1,118 @@
+package ai
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/scottyeager/pal/config"
+)
+
+func TestOpenAIReasoningModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"gpt-4o", false},
+		{"o1", true},
+		{"o3-mini", true},
+		{"o4-mini", true},
+		{"openai/o3", true},
+		{"gpt-5", true},
+		{"gpt-5-mini", true},
+		{"gpt-5-chat-latest", false},
+		{"olmo-2", false},
+	}
+
+	for _, tt := range tests {
+		if got := openaiReasoningModel(tt.model); got != tt.want {
+			t.Errorf("openaiReasoningModel(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestOpenAIChatModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  bool
+	}{
+		{"gpt-4.1", true},
+		{"o3-mini", true},
+		{"chatgpt-4o-latest", true},
+		{"deepseek-chat", true},
+		{"text-embedding-3-small", false},
+		{"mistral-embed", false},
+		{"whisper-1", false},
+		{"tts-1-hd", false},
+		{"gpt-4o-mini-transcribe", false},
+		{"dall-e-3", false},
+		{"gpt-image-1", false},
+		{"omni-moderation-latest", false},
+		{"gpt-4o-realtime-preview", false},
+		{"gpt-4o-audio-preview", false},
+		{"davinci-002", false},
+	}
+
+	for _, tt := range tests {
+		if got := openaiChatModel(tt.model); got != tt.want {
+			t.Errorf("openaiChatModel(%q) = %v, want %v", tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestOpenAIParams(t *testing.T) {
+	b := &openaiBackend{}
+	topP := 0.5
+
+	params := b.params(Request{Model: "o3", Temperature: 1, MaxTokens: 1000, Params: config.Params{TopP: &topP}})
+	if params.Temperature.Valid() || params.TopP.Valid() || params.MaxTokens.Valid() {
+		t.Errorf("sampling parameters sent to a reasoning model")
+	}
+	if params.MaxCompletionTokens.Value != 1000 {
+		t.Errorf("max_completion_tokens = %d, want 1000", params.MaxCompletionTokens.Value)
+	}
+
+	params = b.params(Request{Model: "gpt-4o", Temperature: 1, Params: config.Params{TopP: &topP, Omit: []string{"temperature"}}})
+	if params.Temperature.Valid() {
+		t.Errorf("omitted temperature was sent")
+	}
+	if params.TopP.Value != 0.5 {
+		t.Errorf("top_p = %v, want 0.5", params.TopP.Value)
+	}
+	if params.MaxTokens.Valid() {
+		t.Errorf("max_tokens sent without a limit configured")
+	}
+}
+
+func TestOpenAIAzure(t *testing.T) {
+	var got *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "hi"}}]}`))
+	}))
+	defer server.Close()
+
+	t.Setenv("OPENAI_API_KEY", "from-env")
+	backend, err := newOpenAIBackend("azure", config.Provider{
+		URL:         server.URL + "/openai/deployments/{model}/",
+		APIKey:      "secret",
+		AuthStyle:   config.AuthAPIKey,
+		Headers:     map[string]string{"X-Title": "pal"},
+		QueryParams: map[string]string{"api-version": "2024-10-21"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := backend.Complete(context.Background(), Request{Model: "my-gpt", Messages: userPrompt("hello")}); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.URL.Path != "/openai/deployments/my-gpt/chat/completions" || got.URL.Query().Get("api-version") != "2024-10-21" {
+		t.Errorf("request sent to %s", got.URL)
+	}
+	if got.Header.Get("Api-Key") != "secret" || got.Header.Get("Authorization") != "" || got.Header.Get("X-Title") != "pal" {
+		t.Errorf("unexpected headers %v", got.Header)
+	}
+}
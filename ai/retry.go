@@ -0,0 +1,167 @@
+package ai
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	anthropic "github.com/anthropics/anthropic-sdk-go"
+	openai "github.com/openai/openai-go/v3"
+	"github.com/scottyeager/pal/config"
+)
+
+// withRetries calls attempt until it succeeds, fails with an error that's
+// not worth retrying, or runs out of attempts. Waits between attempts grow
+// exponentially, unless the provider tells us how long to wait.
+func withRetries(ctx context.Context, retry config.Retry, name string, attempt func() error) error {
+	maxAttempts := retry.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = config.DefaultMaxAttempts
+	}
+	backoff := retry.InitialBackoff
+	if backoff <= 0 {
+		backoff = config.DefaultInitialBackoff
+	}
+	maxBackoff := retry.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = config.DefaultMaxBackoff
+	}
+
+	for i := 1; ; i++ {
+		err := attempt()
+		if err == nil {
+			return nil
+		}
+
+		shouldRetry, retryAfter := retryable(err)
+		if !shouldRetry || i >= maxAttempts || ctx.Err() != nil {
+			return err
+		}
+
+		wait := backoff
+		if retryAfter > 0 {
+			// Waiting longer than we're willing to is the same as failing
+			if retryAfter > maxBackoff {
+				return err
+			}
+			wait = retryAfter
+		}
+
+		fmt.Fprintf(os.Stderr, "Request to %s failed (attempt %d of %d), retrying in %s: %v\n", name, i, maxAttempts, wait, SummarizeError(err))
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		backoff = min(backoff*2, maxBackoff)
+	}
+}
+
+// noRetry wraps errors that must not be retried, whatever their cause
+type noRetry struct {
+	error
+}
+
+func (e noRetry) Unwrap() error {
+	return e.error
+}
+
+// retryable reports whether err is likely to go away if the request is
+// repeated, and how long the provider asked us to wait if it said so
+func retryable(err error) (bool, time.Duration) {
+	if errors.As(err, &noRetry{}) {
+		return false, 0
+	}
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		return retryableStatus(openaiErr.StatusCode), retryAfter(openaiErr.Response)
+	}
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		return retryableStatus(anthropicErr.StatusCode), retryAfter(anthropicErr.Response)
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return retryableStatus(httpErr.StatusCode), retryAfter(httpErr.Response)
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return false, 0
+	}
+	// The caller checks whether the overall deadline has passed, so this is a
+	// per request timeout
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true, 0
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) {
+		return true, 0
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true, 0
+	}
+	return false, 0
+}
+
+func retryableStatus(status int) bool {
+	return status == http.StatusRequestTimeout ||
+		status == http.StatusConflict ||
+		status == http.StatusTooManyRequests ||
+		status >= 500
+}
+
+func retryAfter(resp *http.Response) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	// Non standard, but sent by OpenAI and more precise when present
+	if ms, err := strconv.ParseFloat(resp.Header.Get("Retry-After-Ms"), 64); err == nil && ms > 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	header := resp.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(header, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date)
+	}
+	return 0
+}
+
+// SummarizeError shortens SDK errors, which include the whole response body,
+// to just the status for progress messages
+func SummarizeError(err error) string {
+	if status := StatusCode(err); status != 0 {
+		return fmt.Sprintf("%d %s", status, http.StatusText(status))
+	}
+	return err.Error()
+}
+
+// StatusCode returns the HTTP status of a failed request, or 0 if the error
+// didn't come from the provider
+func StatusCode(err error) int {
+	var openaiErr *openai.Error
+	if errors.As(err, &openaiErr) {
+		return openaiErr.StatusCode
+	}
+	var anthropicErr *anthropic.Error
+	if errors.As(err, &anthropicErr) {
+		return anthropicErr.StatusCode
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode
+	}
+	return 0
+}
@@ -0,0 +1,228 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// StreamPrinter writes a streamed completion to a file. When the file is a
+// terminal, text is shown as it arrives and markdown is re-rendered as each
+// line completes. Otherwise nothing is written until Finish, so redirected
+// output only ever contains the complete text.
+type StreamPrinter struct {
+	out      *os.File
+	tty      bool
+	markdown bool
+
+	raw strings.Builder
+	// For markdown, blocks before this offset in raw are rendered for good.
+	// Text after it is drawn in a region that gets redrawn as it grows
+	committed int
+	// What's currently shown in the redraw region, and how much of raw it
+	// covers (counting from committed)
+	drawn   string
+	drawnTo int
+	// Set when the redraw region no longer fits on screen. From then on, raw
+	// text is printed as is
+	plain bool
+}
+
+func NewStreamPrinter(out *os.File, formatMarkdown bool) *StreamPrinter {
+	return &StreamPrinter{
+		out:      out,
+		tty:      term.IsTerminal(int(out.Fd())),
+		markdown: formatMarkdown,
+	}
+}
+
+// Write is meant to be passed as the onDelta argument of StreamCompletion
+func (p *StreamPrinter) Write(delta string) {
+	p.raw.WriteString(delta)
+	if !p.tty {
+		return
+	}
+
+	if !p.markdown || p.plain {
+		p.draw(delta)
+		p.drawnTo += len(delta)
+		return
+	}
+
+	// Rendering partial lines makes for a lot of flicker, so only redraw once
+	// a line is complete
+	if strings.Contains(delta, "\n") {
+		p.redraw()
+	}
+}
+
+// Finish prints the final version of the completion. This can differ from
+// what was streamed, for example when the caller sanitizes the output. On a
+// terminal, the streamed text is replaced if it's still on screen.
+func (p *StreamPrinter) Finish(final string) {
+	if !p.tty {
+		if p.markdown {
+			if formatted, err := renderMarkdown(final); err == nil {
+				final = formatted
+			}
+		}
+		fmt.Fprintln(p.out, final)
+		return
+	}
+
+	raw := p.raw.String()
+	if p.committed > 0 {
+		// We can't take back what's already committed, so just finish
+		// rendering the rest of the stream
+		final = raw[p.committed:]
+	} else if final == raw && (!p.markdown || p.plain) {
+		fmt.Fprintln(p.out)
+		return
+	}
+
+	if !p.clear() {
+		fmt.Fprintln(p.out)
+		return
+	}
+	if p.markdown && !p.plain {
+		if formatted, err := renderMarkdown(final); err == nil {
+			final = formatted
+		}
+	}
+	fmt.Fprintln(p.out, final)
+}
+
+// Flush renders everything written so far for good, so that other output,
+// like a tool transcript on stderr, can follow it without being redrawn over
+func (p *StreamPrinter) Flush() {
+	raw := p.raw.String()
+	if !p.tty || p.committed == len(raw) {
+		return
+	}
+
+	pending := raw[p.committed:]
+	if p.markdown && !p.plain && p.clear() {
+		if rendered, err := renderMarkdown(pending); err == nil {
+			pending = rendered
+		}
+		fmt.Fprint(p.out, pending)
+	} else if p.markdown && !p.plain {
+		fmt.Fprint(p.out, pending[p.drawnTo:])
+	}
+	if !strings.HasSuffix(pending, "\n") {
+		fmt.Fprintln(p.out)
+	}
+	p.committed = len(raw)
+	p.drawn = ""
+	p.drawnTo = 0
+}
+
+func (p *StreamPrinter) redraw() {
+	pending := p.raw.String()[p.committed:]
+
+	// Once a block is complete, render it one last time and leave it be
+	if split := blockBoundary(pending); split > 0 {
+		rendered, err := renderMarkdown(pending[:split])
+		if err == nil && p.clear() {
+			fmt.Fprint(p.out, rendered)
+			p.committed += split
+			pending = pending[split:]
+		}
+	}
+
+	end := strings.LastIndex(pending, "\n")
+	if end == -1 {
+		return
+	}
+	rendered, err := renderMarkdown(pending[:end+1])
+	if err != nil || rendered == p.drawn {
+		return
+	}
+	if !p.clear() {
+		// Too much to redraw, so fall back to printing the raw text
+		p.plain = true
+		fmt.Fprint(p.out, "\n"+pending[p.drawnTo:])
+		p.drawnTo = len(pending)
+		return
+	}
+	p.draw(rendered)
+	p.drawnTo = end + 1
+}
+
+func (p *StreamPrinter) draw(s string) {
+	fmt.Fprint(p.out, s)
+	p.drawn += s
+}
+
+// clear erases the redraw region, if it still fits on screen
+func (p *StreamPrinter) clear() bool {
+	if p.drawn == "" {
+		p.drawnTo = 0
+		return true
+	}
+	width, height, err := term.GetSize(int(p.out.Fd()))
+	if err != nil || width <= 0 {
+		return false
+	}
+	rows := cursorRows(p.drawn, width)
+	if rows >= height {
+		return false
+	}
+	if rows > 0 {
+		fmt.Fprintf(p.out, "\033[%dA", rows)
+	}
+	fmt.Fprint(p.out, "\r\033[J")
+	p.drawn = ""
+	p.drawnTo = 0
+	return true
+}
+
+var ansiEscape = regexp.MustCompile("\x1b\\[[0-9;?]*[a-zA-Z]")
+
+// cursorRows returns how many rows the cursor moved down while printing s,
+// starting from the first column
+func cursorRows(s string, width int) int {
+	lines := strings.Split(ansiEscape.ReplaceAllString(s, ""), "\n")
+	rows := 0
+	for i, line := range lines {
+		w := utf8.RuneCountInString(line)
+		if i < len(lines)-1 {
+			rows += 1 + max(w-1, 0)/width
+		} else {
+			rows += w / width
+		}
+	}
+	return rows
+}
+
+// blockBoundary returns the offset just past the last blank line in s that
+// isn't inside a code fence, or 0 if there isn't one
+func blockBoundary(s string) int {
+	boundary := 0
+	offset := 0
+	inFence := false
+	afterText := false
+	for _, line := range strings.SplitAfter(s, "\n") {
+		offset += len(line)
+		if !strings.HasSuffix(line, "\n") {
+			break
+		}
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+		}
+		if trimmed == "" {
+			if !inFence && afterText {
+				boundary = offset
+			}
+			afterText = false
+		} else {
+			afterText = true
+		}
+	}
+	return boundary
+}
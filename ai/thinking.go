@@ -0,0 +1,142 @@
+package ai
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ShowThinking prints the reasoning of thinking models to stderr. Otherwise
+// it's discarded
+var ShowThinking bool
+
+const (
+	thinkStart = "<think>"
+	thinkEnd   = "</think>"
+)
+
+// splitThinking separates a <think> block, as emitted by models like the
+// DeepSeek R1 distills, from the answer. Some models leave out the opening
+// tag, so a closing tag alone also counts, with everything before it being
+// reasoning.
+func splitThinking(completion string) (answer string, reasoning string) {
+	trimmed := strings.TrimLeft(completion, " \t\r\n")
+	if rest, ok := strings.CutPrefix(trimmed, thinkStart); ok {
+		if reasoning, answer, ok := strings.Cut(rest, thinkEnd); ok {
+			return strings.TrimLeft(answer, " \t\r\n"), strings.TrimSpace(reasoning)
+		}
+		// The answer never came, likely because the model ran out of tokens
+		return "", strings.TrimSpace(rest)
+	}
+	if reasoning, answer, ok := strings.Cut(completion, thinkEnd); ok && !strings.Contains(reasoning, thinkStart) {
+		return strings.TrimLeft(answer, " \t\r\n"), strings.TrimSpace(reasoning)
+	}
+	return completion, ""
+}
+
+// thinkSplitter does the same as splitThinking, but on a stream of text. A
+// <think> block is only recognized at the start of the response, so that
+// answers which mention the tag are left alone.
+type thinkSplitter struct {
+	// Text that may be the start of a tag, waiting on the next delta
+	pending  string
+	started  bool
+	thinking bool
+	// After a <think> block, whitespace before the answer is dropped
+	trimming bool
+}
+
+func (s *thinkSplitter) write(text string) (answer string, reasoning string) {
+	buf := s.pending + text
+	s.pending = ""
+
+	if !s.started {
+		trimmed := strings.TrimLeft(buf, " \t\r\n")
+		if trimmed == "" || strings.HasPrefix(thinkStart, trimmed) {
+			// Can't tell yet
+			s.pending = buf
+			return "", ""
+		}
+		s.started = true
+		if rest, ok := strings.CutPrefix(trimmed, thinkStart); ok {
+			s.thinking = true
+			buf = rest
+		}
+	}
+
+	if s.thinking {
+		if before, after, ok := strings.Cut(buf, thinkEnd); ok {
+			s.thinking = false
+			s.trimming = true
+			reasoning = before
+			buf = after
+		} else {
+			// Hold back anything that could be the start of the closing tag
+			keep := partialSuffix(buf, thinkEnd)
+			s.pending = buf[len(buf)-keep:]
+			return "", buf[:len(buf)-keep]
+		}
+	}
+
+	if s.trimming {
+		buf = strings.TrimLeft(buf, " \t\r\n")
+		if buf != "" {
+			s.trimming = false
+		}
+	}
+	return buf, reasoning
+}
+
+// flush returns any text held back once the stream has ended
+func (s *thinkSplitter) flush() (answer string, reasoning string) {
+	pending := s.pending
+	s.pending = ""
+	if s.thinking {
+		return "", pending
+	}
+	return pending, ""
+}
+
+// partialSuffix returns the length of the longest suffix of text that is a
+// prefix of tag
+func partialSuffix(text string, tag string) int {
+	for n := min(len(tag)-1, len(text)); n > 0; n-- {
+		if strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
+
+// reasoningPrinter writes reasoning to stderr, dimmed if it's a terminal, so
+// it can be told apart from the answer
+type reasoningPrinter struct {
+	dim     bool
+	printed bool
+}
+
+func newReasoningPrinter() *reasoningPrinter {
+	return &reasoningPrinter{dim: term.IsTerminal(int(os.Stderr.Fd()))}
+}
+
+func (p *reasoningPrinter) print(reasoning string) {
+	if !ShowThinking || reasoning == "" {
+		return
+	}
+	if p.dim {
+		fmt.Fprint(os.Stderr, "\033[2m"+reasoning+"\033[0m")
+	} else {
+		fmt.Fprint(os.Stderr, reasoning)
+	}
+	p.printed = true
+}
+
+// finish separates the reasoning from the answer that follows
+func (p *reasoningPrinter) finish() {
+	if p.printed {
+		fmt.Fprint(os.Stderr, "\n\n")
+		p.printed = false
+	}
+}
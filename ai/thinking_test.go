@@ -0,0 +1,61 @@
+package ai
+
+import "testing"
+
+func TestSplitThinking(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		answer    string
+		reasoning string
+	}{
+		{"no thinking", "ls -la", "ls -la", ""},
+		{"think block", "<think>\nlist files\n</think>\n\nls -la", "ls -la", "list files"},
+		{"leading whitespace", "\n<think>hmm</think>ls", "ls", "hmm"},
+		{"closing tag only", "list files\n</think>\n\nls -la", "ls -la", "list files"},
+		{"unfinished", "<think>still going", "", "still going"},
+		{"tag mentioned in answer", "Models emit <think> tags", "Models emit <think> tags", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			answer, reasoning := splitThinking(tt.input)
+			if answer != tt.answer || reasoning != tt.reasoning {
+				t.Errorf("splitThinking(%q) = %q, %q, want %q, %q", tt.input, answer, reasoning, tt.answer, tt.reasoning)
+			}
+		})
+	}
+}
+
+func TestThinkSplitter(t *testing.T) {
+	tests := []struct {
+		name      string
+		deltas    []string
+		answer    string
+		reasoning string
+	}{
+		{"no thinking", []string{"ls ", "-la"}, "ls -la", ""},
+		{"tags split across deltas", []string{"<th", "ink>list ", "files</th", "ink>\n", "\nls -la"}, "ls -la", "list files"},
+		{"whole block in one delta", []string{"<think>hmm</think>ls"}, "ls", "hmm"},
+		{"tag mentioned in answer", []string{"Models emit ", "<think>", " tags"}, "Models emit <think> tags", ""},
+		{"short answer", []string{"<"}, "<", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s thinkSplitter
+			var answer, reasoning string
+			for _, delta := range tt.deltas {
+				a, r := s.write(delta)
+				answer += a
+				reasoning += r
+			}
+			a, r := s.flush()
+			answer += a
+			reasoning += r
+			if answer != tt.answer || reasoning != tt.reasoning {
+				t.Errorf("got %q, %q, want %q, %q", answer, reasoning, tt.answer, tt.reasoning)
+			}
+		})
+	}
+}
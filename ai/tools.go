@@ -0,0 +1,80 @@
+package ai
+
+import (
+	"context"
+	"slices"
+)
+
+// ToolDef describes a tool the model can call
+type ToolDef struct {
+	Name        string
+	Description string
+	// A JSON schema for the arguments
+	Parameters map[string]any
+}
+
+// ToolCall is a request from the model to run a tool
+type ToolCall struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// The arguments as a JSON object
+	Arguments string `json:"arguments"`
+}
+
+// maxToolRounds limits how many times the model can go back to calling tools
+// before it has to answer
+const maxToolRounds = 10
+
+// StreamChatWithTools is like StreamChat, but the model can call tools. Each
+// call is passed to run, and whatever it returns is sent back to the model as
+// the result. Text the model writes in between tool calls is part of the
+// answer, so the returned text is everything it wrote.
+//
+// Backends that don't support tools simply answer without calling any.
+func (c *Client) StreamChatWithTools(ctx context.Context, system_prompt string, messages []Message, temperature float64, tools []ToolDef, run func(context.Context, ToolCall) string, onDelta func(string)) (string, error) {
+	if onDelta == nil {
+		onDelta = func(string) {}
+	}
+	messages = slices.Clone(messages)
+
+	var answer string
+	for round := 0; ; round++ {
+		req := Request{System: system_prompt, Messages: messages, Temperature: temperature}
+		if round < maxToolRounds {
+			req.Tools = tools
+		}
+
+		// Keep what the model writes after a tool call apart from what came
+		// before it
+		separated := answer == ""
+		resp, err := c.complete(ctx, req, func(delta string) {
+			if !separated {
+				onDelta("\n\n")
+				separated = true
+			}
+			onDelta(delta)
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if text := stripToolCall(resp.Text); text != "" {
+			if answer != "" {
+				answer += "\n\n"
+			}
+			answer += text
+		}
+		if len(resp.ToolCalls) == 0 {
+			return answer, nil
+		}
+
+		messages = append(messages, Message{Role: "assistant", Content: resp.Text, ToolCalls: resp.ToolCalls})
+		for _, call := range resp.ToolCalls {
+			result := run(ctx, call)
+			if err := ctx.Err(); err != nil {
+				return "", err
+			}
+			messages = append(messages, Message{Role: "tool", Content: result, ToolCallID: call.ID, ToolName: call.Name})
+		}
+	}
+}
@@ -78,14 +78,18 @@ Use with the output of the /edit command.`,
 
 		// Get model for apply command
 		applyModel := config.GetSelectedModel(cfg, "apply")
-		client, err := ai.NewClient(cfg, applyModel)
+		client, err := ai.NewCommandClient(cfg, "apply")
 		if err != nil {
 			return fmt.Errorf("error creating AI client: %v", err)
 		}
+		applyPrompt, err := systemPrompt(cfg, "apply")
+		if err != nil {
+			return err
+		}
 
 		appliedCount := 0
 		for _, edit := range edits {
-			err := applyEdit(client, edit, applyModel)
+			err := applyEdit(cmd.Context(), client, applyPrompt, edit, applyModel)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "Error applying edit to %s: %v\n", edit.FilePath, err)
 				continue
@@ -161,7 +165,7 @@ func parseEdits(input string) ([]Edit, error) {
 	return edits, nil
 }
 
-func applyEdit(client *ai.Client, edit Edit, model string) error {
+func applyEdit(ctx context.Context, client *ai.Client, systemPrompt string, edit Edit, model string) error {
 	// Read the original file content
 	originalContent, err := os.ReadFile(edit.FilePath)
 	if err != nil {
@@ -176,13 +180,13 @@ func applyEdit(client *ai.Client, edit Edit, model string) error {
 	)
 
 	// Get the completion from the AI
-	response, err := client.GetCompletion(context.Background(), applySystemPrompt, applyPrompt, false, 0.0, false, model)
+	response, err := client.GetCompletion(ctx, systemPrompt, applyPrompt, false, 0.0, false, model)
 	if err != nil {
 		return fmt.Errorf("failed to get completion: %w", err)
 	}
 
 	// Write the response to the file
-	err = os.WriteFile(edit.FilePath, []byte(response), 0644)
+	err = inout.WriteFileAtomic(edit.FilePath, []byte(response), 0644)
 	if err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
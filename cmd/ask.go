@@ -3,16 +3,23 @@ package cmd
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/scottyeager/pal/ai"
 	"github.com/scottyeager/pal/config"
 	"github.com/scottyeager/pal/inout"
+	"github.com/scottyeager/pal/session"
+	"github.com/scottyeager/pal/tools"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	rootCmd.AddCommand(askCmd)
+	askCmd.Flags().BoolP("continue", "c", false, "Continue the last session with a follow up question")
+	askCmd.Flags().StringP("session", "s", "", "Continue the named session, or start a new one with this name")
+	askCmd.Flags().StringArray("attach", nil, "Attach an image or PDF file to the question. Can be given more than once")
+	askCmd.Flags().Bool("tools", false, "Let the model inspect your system with read only tools. Each tool call is confirmed first")
 }
 
 var askCmd = &cobra.Command{
@@ -27,10 +34,20 @@ var askCmd = &cobra.Command{
 			return err
 		}
 
-		if len(userMessage) == 0 && len(stdinInput) == 0 {
+		attachPaths, _ := cmd.Flags().GetStringArray("attach")
+		if len(userMessage) == 0 && len(stdinInput) == 0 && len(attachPaths) == 0 {
 			return fmt.Errorf("No input detected. Please write or pipe in a query")
 		}
 
+		var attachments []ai.Attachment
+		for _, path := range attachPaths {
+			attachment, err := ai.LoadAttachment(path)
+			if err != nil {
+				return err
+			}
+			attachments = append(attachments, attachment)
+		}
+
 		cfg, err := config.LoadConfig()
 		if err != nil {
 			return fmt.Errorf("error loading config: %w", err)
@@ -42,7 +59,7 @@ var askCmd = &cobra.Command{
 
 		askModel := config.GetSelectedModel(cfg, "ask")
 
-		aiClient, err := ai.NewClient(cfg, askModel)
+		aiClient, err := ai.NewCommandClient(cfg, "ask")
 		if err != nil {
 			return fmt.Errorf("error creating AI client: %w", err)
 		}
@@ -53,6 +70,9 @@ var askCmd = &cobra.Command{
 		} else {
 			question = strings.Join(userMessage, " ")
 		}
+		if question == "" {
+			question = "What can you tell me about the attached files?"
+		}
 
 		var formatMarkdown bool
 		if markdown {
@@ -61,10 +81,9 @@ var askCmd = &cobra.Command{
 			formatMarkdown = cfg.FormatMarkdown
 		}
 
-		system_prompt := "You are a helpful assistant that runs in the users shell but can answer on any topic. Keep responses concise"
-
-		if !cfg.FormatMarkdown {
-			system_prompt += " and avoid using Markdown formatting that won't render in a shell. Lists and bullets are fine, but avoid headings, bold, and italic text."
+		system_prompt, err := systemPrompt(cfg, "ask")
+		if err != nil {
+			return err
 		}
 
 		t := 1.0
@@ -72,12 +91,93 @@ var askCmd = &cobra.Command{
 			t = temperature
 		}
 
-		response, err := aiClient.GetCompletion(context.Background(), system_prompt, question, false, t, formatMarkdown, askModel)
+		// Name new sessions after the user's query rather than stdin contents
+		title := strings.Join(userMessage, " ")
+		if title == "" && stdinInput == "" && len(attachments) > 0 {
+			title = attachments[0].Name
+		}
+		if title == "" {
+			title = question
+		}
+		s, err := askSession(cmd, title, askModel)
+		if err != nil {
+			return err
+		}
+		s.Messages = append(s.Messages, ai.Message{Role: "user", Content: question, Attachments: attachments})
+
+		useTools, _ := cmd.Flags().GetBool("tools")
+		useTools = useTools || cfg.Tools.Enabled
+
+		printer := ai.NewStreamPrinter(os.Stdout, formatMarkdown)
+		var response string
+		if useTools {
+			if !strings.HasSuffix(system_prompt, ".") {
+				system_prompt += "."
+			}
+			system_prompt += " You can use tools to inspect the user's system. Use them when the answer depends on the state of the system, like files, logs or services, instead of guessing."
+			runner := tools.NewRunner(cfg.Tools)
+			run := func(ctx context.Context, call ai.ToolCall) string {
+				// Get the answer so far out of the way of the transcript
+				printer.Flush()
+				return runner.Run(ctx, call)
+			}
+			response, err = aiClient.StreamChatWithTools(cmd.Context(), system_prompt, s.Messages, t, runner.Definitions(), run, printer.Write)
+		} else {
+			response, err = aiClient.StreamChat(cmd.Context(), system_prompt, s.Messages, t, printer.Write)
+		}
 		if err != nil {
 			return fmt.Errorf("error getting completion: %w", err)
 		}
 
-		fmt.Println(response)
+		printer.Finish(response)
+
+		s.Messages = append(s.Messages, ai.Message{Role: "assistant", Content: response})
+		if err := session.Save(s); err != nil {
+			return fmt.Errorf("error saving session: %w", err)
+		}
 		return nil
 	},
 }
+
+func askSystemPrompt(cfg *config.Config) string {
+	prompt := "You are a helpful assistant that runs in the users shell but can answer on any topic. Keep responses concise"
+	if !cfg.FormatMarkdown {
+		prompt += " and avoid using Markdown formatting that won't render in a shell. Lists and bullets are fine, but avoid headings, bold, and italic text."
+	}
+	return prompt
+}
+
+// askSession returns the session this question belongs to. Unless the user
+// asked to continue a session, a new one is started.
+func askSession(cmd *cobra.Command, title string, model string) (*session.Session, error) {
+	name, _ := cmd.Flags().GetString("session")
+	continueLast, _ := cmd.Flags().GetBool("continue")
+
+	if name == "" && continueLast {
+		last, err := session.Last()
+		if err != nil {
+			return nil, err
+		}
+		if last == "" {
+			return nil, fmt.Errorf("No previous session to continue. Run 'pal /sessions' to list sessions")
+		}
+		name = last
+	}
+
+	if name != "" {
+		exists, err := session.Exists(name)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			return session.Load(name)
+		}
+		return session.New(name, model)
+	}
+
+	name, err := session.NameFor(title)
+	if err != nil {
+		return nil, err
+	}
+	return session.New(name, model)
+}
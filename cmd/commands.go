@@ -1,14 +1,17 @@
 package cmd
 
 import (
-	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"regexp"
 	"strings"
 
 	"github.com/scottyeager/pal/ai"
 	"github.com/scottyeager/pal/config"
 	"github.com/scottyeager/pal/inout"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func init() {
@@ -54,35 +57,210 @@ func Commands(cmd cobra.Command, query []string) error {
 		return err
 	}
 
-	// Get model for cmd command
-	cmdModel := config.GetSelectedModel(cfg, "cmd")
-
-	aiClient, err := ai.NewClient(cfg, cmdModel)
+	aiClient, err := ai.NewCommandClient(cfg, "cmd")
 	if err != nil {
 		return fmt.Errorf("error creating AI client: %v", err)
 	}
 
-	system_prompt := "You are a helpful assistant that suggests shell commands. Each command is a single line that can run in the shell. Respond with three command options, one per line. Don't add anything extra, no context, no explanations, no formatting, no code blocks."
+	system_prompt, err := systemPrompt(cfg, "cmd")
+	if err != nil {
+		return err
+	}
 
 	t := 0.0
 	if cmd.Flags().Changed("temperature") {
 		t = temperature
 	}
-	response, err := aiClient.GetCompletion(context.Background(), system_prompt, question, true, t, false, cmdModel)
+	response, err := aiClient.GetJSON(cmd.Context(), system_prompt, question, t, suggestionSchema)
 	if err != nil {
 		return fmt.Errorf("error getting completion: %v", err)
 	}
 
-	// Remove any blank lines (weaker models tend to return them)
-	lines := strings.Split(response, "\n")
-	var nonEmptyLines []string
+	result, err := parseSuggestions(response)
+	if err != nil {
+		return err
+	}
+	if err := storeSuggestions(result); err != nil {
+		return fmt.Errorf("error getting completion: failed to write to disk: %w", err)
+	}
+	printSuggestions(result)
+	return nil
+}
+
+const cmdSystemPrompt = "You are a helpful assistant that suggests shell commands. Each command is a single line that can run in the shell. Suggest three command options, each with a one line explanation of what it does. Respond with only a JSON object like this, without code blocks: " +
+	`{"commands": [{"command": "...", "explanation": "..."}], "message": ""}. ` +
+	"If you can't suggest a command, leave commands empty and explain why in message."
+
+// storeSuggestions writes the commands to the expansions file, one per line.
+// Without commands, like when the model refuses, the previous ones are kept
+func storeSuggestions(result suggestions) error {
+	if len(result.Commands) == 0 {
+		return nil
+	}
+	var commands []string
+	for _, s := range result.Commands {
+		commands = append(commands, s.Command)
+	}
+	return inout.StoreCommands(strings.Join(commands, "\n"))
+}
+
+// printSuggestions lists the commands, with their explanations dimmed
+// underneath on a terminal
+func printSuggestions(result suggestions) {
+	if len(result.Commands) == 0 {
+		fmt.Println(result.Message)
+		return
+	}
+
+	dim := term.IsTerminal(int(os.Stdout.Fd()))
+	for i, s := range result.Commands {
+		fmt.Printf("%d. %s\n", i+1, s.Command)
+		if s.Explanation == "" {
+			continue
+		}
+		if dim {
+			fmt.Printf("   \033[2m%s\033[0m\n", s.Explanation)
+		} else {
+			fmt.Printf("   %s\n", s.Explanation)
+		}
+	}
+}
+
+type suggestion struct {
+	Command     string `json:"command"`
+	Explanation string `json:"explanation"`
+}
+
+type suggestions struct {
+	Commands []suggestion `json:"commands"`
+	// Why there are no commands, if there aren't any
+	Message string `json:"message"`
+}
+
+var suggestionSchema = &ai.Schema{
+	Name:        "suggest_commands",
+	Description: "Suggest shell commands that accomplish the user's task",
+	Schema: map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"commands": map[string]any{
+				"type":        "array",
+				"description": "Three commands, best first",
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"command": map[string]any{
+							"type":        "string",
+							"description": "A single line that can run in the shell",
+						},
+						"explanation": map[string]any{
+							"type":        "string",
+							"description": "One short line explaining what the command does",
+						},
+					},
+					"required":             []string{"command", "explanation"},
+					"additionalProperties": false,
+				},
+			},
+			"message": map[string]any{
+				"type":        "string",
+				"description": "If no command fits, why not. Otherwise empty",
+			},
+		},
+		"required":             []string{"commands", "message"},
+		"additionalProperties": false,
+	},
+}
+
+// parseSuggestions reads the model's suggestions. Models without structured
+// output sometimes wrap the JSON in prose or code blocks, or ignore the
+// requested format entirely and return commands in code blocks or a list, so
+// each of those is handled too. Anything else is an error, since prose must
+// never end up in the expansions file.
+func parseSuggestions(response string) (suggestions, error) {
+	var result suggestions
+	start := strings.Index(response, "{")
+	end := strings.LastIndex(response, "}")
+	if start != -1 && end > start && json.Unmarshal([]byte(response[start:end+1]), &result) == nil &&
+		(len(result.Commands) > 0 || result.Message != "") {
+		var cleaned []suggestion
+		for _, s := range result.Commands {
+			s.Command = cleanCommand(s.Command)
+			s.Explanation = strings.Join(strings.Fields(s.Explanation), " ")
+			if s.Command != "" {
+				cleaned = append(cleaned, s)
+			}
+		}
+		result.Commands = cleaned
+		return result, nil
+	}
+
+	result = parseSuggestionLines(response)
+	if len(result.Commands) == 0 {
+		return result, fmt.Errorf("no commands found in the response:\n%s", strings.TrimSpace(response))
+	}
+	return result, nil
+}
+
+var listMarker = regexp.MustCompile(`^(\d+[.):]|[-*•])\s+`)
+
+// parseSuggestionLines takes the commands from the lines inside code blocks,
+// or if there aren't any, from the list items, dropping numbering and
+// formatting. Other lines are taken to be prose.
+func parseSuggestionLines(response string) suggestions {
+	var lines []string
+	if strings.Count(response, "```") >= 2 {
+		inBlock := false
+		for _, line := range strings.Split(response, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), "```") {
+				inBlock = !inBlock
+				continue
+			}
+			if inBlock {
+				lines = append(lines, line)
+			}
+		}
+	} else {
+		for _, line := range strings.Split(response, "\n") {
+			if listMarker.MatchString(strings.TrimSpace(line)) {
+				lines = append(lines, line)
+			}
+		}
+	}
+
+	var result suggestions
 	for _, line := range lines {
-		if len(strings.TrimSpace(line)) > 0 {
-			nonEmptyLines = append(nonEmptyLines, line)
+		line = strings.TrimSpace(line)
+		line = listMarker.ReplaceAllString(line, "")
+
+		var s suggestion
+		// Like "`ls -la` - list all files"
+		if strings.HasPrefix(line, "`") {
+			if command, rest, ok := strings.Cut(line[1:], "`"); ok {
+				s.Command = command
+				s.Explanation = strings.TrimLeft(rest, " -–—:")
+			}
+		}
+		if s.Command == "" {
+			s.Command = line
+		}
+		s.Command = cleanCommand(s.Command)
+		if s.Command != "" {
+			result.Commands = append(result.Commands, s)
 		}
 	}
-	response = strings.Join(nonEmptyLines, "\n")
+	return result
+}
 
-	fmt.Println(response)
-	return nil
+// cleanCommand makes a command fit on one line of the expansions file
+func cleanCommand(command string) string {
+	command = strings.TrimSpace(command)
+	command = strings.Trim(command, "`")
+	command = strings.TrimPrefix(command, "$ ")
+	command = strings.ReplaceAll(command, "\\\n", " ")
+	lines := strings.Split(command, "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSpace(lines[i])
+	}
+	return strings.TrimSpace(strings.Join(lines, "; "))
 }
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSuggestions(t *testing.T) {
+	tests := []struct {
+		name     string
+		response string
+		expected suggestions
+	}{
+		{
+			name:     "json",
+			response: `{"commands": [{"command": "ls -la", "explanation": "List all files"}, {"command": "ls -lh", "explanation": "Human readable sizes"}], "message": ""}`,
+			expected: suggestions{Commands: []suggestion{{"ls -la", "List all files"}, {"ls -lh", "Human readable sizes"}}},
+		},
+		{
+			name:     "json in a code block",
+			response: "Here you go:\n```json\n{\"commands\": [{\"command\": \"`df -h`\", \"explanation\": \"Disk usage\"}]}\n```",
+			expected: suggestions{Commands: []suggestion{{"df -h", "Disk usage"}}},
+		},
+		{
+			name:     "refusal",
+			response: `{"commands": [], "message": "That isn't a shell task"}`,
+			expected: suggestions{Commands: []suggestion{}, Message: "That isn't a shell task"},
+		},
+		{
+			name:     "numbered with backticks",
+			response: "1. `ls -la` - List all files\n2) `ls -lh`: Human readable sizes\n- `find . -exec rm {} \\;`",
+			expected: suggestions{Commands: []suggestion{{"ls -la", "List all files"}, {"ls -lh", "Human readable sizes"}, {"find . -exec rm {} \\;", ""}}},
+		},
+		{
+			name:     "prose around a code block",
+			response: "You can use these:\n```bash\n$ ls -la\nls -lh\n```\nHope that helps!",
+			expected: suggestions{Commands: []suggestion{{"ls -la", ""}, {"ls -lh", ""}}},
+		},
+		{
+			name:     "prose around a list",
+			response: "Try one of these:\n\n* `ls -la`\n* `ls -lh`\n\nThe second shows sizes in KB and MB.",
+			expected: suggestions{Commands: []suggestion{{"ls -la", ""}, {"ls -lh", ""}}},
+		},
+		{
+			name:     "multiline command is joined",
+			response: `{"commands": [{"command": "cd /tmp\nls", "explanation": "List\n  tmp"}]}`,
+			expected: suggestions{Commands: []suggestion{{"cd /tmp; ls", "List tmp"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parseSuggestions(tt.response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(result.Commands) == 0 && len(tt.expected.Commands) == 0 {
+				result.Commands, tt.expected.Commands = nil, nil
+			}
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("parseSuggestions(%q) = %+v, want %+v", tt.response, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseSuggestionsProse(t *testing.T) {
+	for _, response := range []string{
+		"ls -la\nls -lh",
+		"I'm sorry, but I can't help with that.\nDeleting system files could break your computer.",
+		`{"commands": [], "message": ""}`,
+	} {
+		if result, err := parseSuggestions(response); err == nil {
+			t.Errorf("parseSuggestions(%q) = %+v, want an error", response, result)
+		}
+	}
+}
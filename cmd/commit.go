@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -32,7 +31,7 @@ var commitCmd = &cobra.Command{
 
 		commitModel := config.GetSelectedModel(cfg, "commit")
 
-		aiClient, err := ai.NewClient(cfg, commitModel)
+		aiClient, err := ai.NewCommandClient(cfg, "commit")
 		if err != nil {
 			return fmt.Errorf("error creating AI client: %w", err)
 		}
@@ -101,29 +100,10 @@ var commitCmd = &cobra.Command{
 		}
 
 		// Generate commit message
-		systemPrompt := `You are a helpful assistant who generates concise and complete git commit messages based on code changes in diff format. Use the Conventional Commit style.
-
-		Follow these guidelines:
-		- Write a single line of 72 characters or less
-		- Use imperative mood (e.g. "Fix bug" not "Fixed bug")
-		- Review the diffs carefully and summarize them at a high level
-		- Check for context in the previous commit messages
-
-		Choose one of the following types to begin the message, only add it on the first line:
-
-		feat: New feature (or general code changes that don't fit under another category)
-		fix: Bug fix
-		docs: Documentation (README files, doc strings, comments, not just any string edits in code)
-		style: Formatting
-		refactor: Code restructuring
-		ci: Continuous integration
-		test: Testing-related
-		chore: Build/config/tooling
-		perf: Performance improvements
-
-		Most commits will be a "feat" or "fix". Use the others only when you are sure it's a good fit.
-
-		Respond only with the commit message. No explanations, additional formatting, or line breaks, please.`
+		commitPrompt, err := systemPrompt(cfg, "commit")
+		if err != nil {
+			return err
+		}
 
 		prompt := `Recent commit history:\n` + string(logOut) + `\n\nDiffs for this commit:\n` + string(diffOut)
 
@@ -134,7 +114,7 @@ var commitCmd = &cobra.Command{
 			t = temperature
 		}
 
-		message, err := aiClient.GetCompletion(context.Background(), systemPrompt, prompt, false, t, false, commitModel)
+		message, err := aiClient.GetCompletion(cmd.Context(), commitPrompt, prompt, false, t, false, commitModel)
 		if err != nil {
 			return fmt.Errorf("failed to generate commit message: %w", err)
 		}
@@ -176,3 +156,27 @@ var commitCmd = &cobra.Command{
 		return nil
 	},
 }
+
+const commitSystemPrompt = `You are a helpful assistant who generates concise and complete git commit messages based on code changes in diff format. Use the Conventional Commit style.
+
+Follow these guidelines:
+- Write a single line of 72 characters or less
+- Use imperative mood (e.g. "Fix bug" not "Fixed bug")
+- Review the diffs carefully and summarize them at a high level
+- Check for context in the previous commit messages
+
+Choose one of the following types to begin the message, only add it on the first line:
+
+feat: New feature (or general code changes that don't fit under another category)
+fix: Bug fix
+docs: Documentation (README files, doc strings, comments, not just any string edits in code)
+style: Formatting
+refactor: Code restructuring
+ci: Continuous integration
+test: Testing-related
+chore: Build/config/tooling
+perf: Performance improvements
+
+Most commits will be a "feat" or "fix". Use the others only when you are sure it's a good fit.
+
+Respond only with the commit message. No explanations, additional formatting, or line breaks, please.`
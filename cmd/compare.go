@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/scottyeager/pal/ai"
+	"github.com/scottyeager/pal/config"
+	"github.com/scottyeager/pal/inout"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+func init() {
+	rootCmd.AddCommand(compareCmd)
+	compareCmd.Flags().StringArrayP("model", "M", nil, "A model to compare, like deepseek/deepseek-chat. Give it once for each model")
+	compareCmd.Flags().Bool("cmd", false, "Compare command suggestions, like /cmd, and pick which to keep")
+	compareCmd.Flags().Int("pick", 0, "With --cmd, write the suggestions of the model with this number to the expansions file without asking")
+}
+
+var compareCmd = &cobra.Command{
+	Use:   "/compare",
+	Short: "Ask several models the same question and compare their answers",
+	Annotations: map[string]string{
+		"takes_user_message": "true",
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		models, _ := cmd.Flags().GetStringArray("model")
+		suggest, _ := cmd.Flags().GetBool("cmd")
+		pick, _ := cmd.Flags().GetInt("pick")
+
+		if len(models) < 2 {
+			return fmt.Errorf("Give at least two models to compare, like: pal /compare -M deepseek/deepseek-chat -M anthropic/claude-sonnet-4-0 <query>")
+		}
+		if pick < 0 || pick > len(models) {
+			return fmt.Errorf("--pick must be between 1 and %d", len(models))
+		}
+
+		stdinInput, err := inout.ReadStdin()
+		if err != nil {
+			return err
+		}
+		if len(userMessage) == 0 && stdinInput == "" {
+			return fmt.Errorf("No input detected. Please write or pipe in a query")
+		}
+		question := strings.Join(userMessage, " ")
+		if stdinInput != "" {
+			question = stdinInput + "\nThat concludes the stdin contents. Now here's the query from the user:\n" + question
+		}
+
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		var clients []*ai.Client
+		for _, model := range models {
+			if !config.ModelConfigured(cfg, model) {
+				return fmt.Errorf("model '%s' not found in any provider", model)
+			}
+			client, err := ai.NewModelClient(cfg, "compare", model)
+			if err != nil {
+				return fmt.Errorf("error creating AI client for %s: %w", model, err)
+			}
+			clients = append(clients, client)
+		}
+
+		promptKey := "ask"
+		if suggest {
+			promptKey = "cmd"
+		}
+		prompt, err := systemPrompt(cfg, promptKey)
+		if err != nil {
+			return err
+		}
+
+		formatMarkdown := cfg.FormatMarkdown != markdown
+		t := 1.0
+		if suggest {
+			t = 0.0
+		}
+		if cmd.Flags().Changed("temperature") {
+			t = temperature
+		}
+
+		// Every model gets its own goroutine. Results are shown in the order
+		// the models were given, each as soon as it and those before it are
+		// done
+		results := make([]*comparison, len(models))
+		for i := range models {
+			results[i] = &comparison{done: make(chan struct{})}
+			go func(c *comparison, client *ai.Client, model string) {
+				defer close(c.done)
+				start := time.Now()
+				if suggest {
+					var response string
+					response, c.err = client.GetJSON(cmd.Context(), prompt, question, t, suggestionSchema)
+					if c.err == nil {
+						c.suggestions, c.err = parseSuggestions(response)
+					}
+				} else {
+					c.answer, c.err = client.GetCompletion(cmd.Context(), prompt, question, false, t, formatMarkdown, model)
+				}
+				c.latency = time.Since(start)
+				c.usage = client.Usage()
+			}(results[i], clients[i], models[i])
+		}
+
+		haveSuggestions := false
+		for i, c := range results {
+			<-c.done
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("=== [%d] %s (%s", i+1, models[i], c.latency.Round(time.Millisecond))
+			if c.usage.InputTokens > 0 || c.usage.OutputTokens > 0 {
+				fmt.Printf(", %d input / %d output tokens", c.usage.InputTokens, c.usage.OutputTokens)
+			}
+			fmt.Println(")")
+
+			switch {
+			case c.err != nil:
+				fmt.Printf("Failed: %v\n", c.err)
+			case suggest:
+				printSuggestions(c.suggestions)
+				haveSuggestions = haveSuggestions || len(c.suggestions.Commands) > 0
+			default:
+				fmt.Println(strings.TrimSpace(c.answer))
+			}
+		}
+		if cmd.Context().Err() != nil {
+			return cmd.Context().Err()
+		}
+
+		if !haveSuggestions {
+			return nil
+		}
+		if pick == 0 {
+			if !term.IsTerminal(int(os.Stdin.Fd())) {
+				return nil
+			}
+			fmt.Printf("\nWrite the suggestions of which model to the expansions file? (1-%d, enter for none): ", len(models))
+			var input string
+			fmt.Scanln(&input)
+			if input == "" {
+				return nil
+			}
+			fmt.Sscanf(input, "%d", &pick)
+		}
+		if pick < 1 || pick > len(models) || results[pick-1].err != nil || len(results[pick-1].suggestions.Commands) == 0 {
+			return fmt.Errorf("model %d has no suggestions to keep", pick)
+		}
+		if err := storeSuggestions(results[pick-1].suggestions); err != nil {
+			return fmt.Errorf("failed to write to disk: %w", err)
+		}
+		fmt.Printf("Kept the suggestions of %s\n", models[pick-1])
+		return nil
+	},
+}
+
+// comparison is the result of one model in /compare
+type comparison struct {
+	done        chan struct{}
+	answer      string
+	suggestions suggestions
+	latency     time.Duration
+	usage       ai.Usage
+	err         error
+}
@@ -4,19 +4,31 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/scottyeager/pal/ai"
 	"github.com/scottyeager/pal/config"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 func init() {
 	rootCmd.AddCommand(configCmd)
+	configCmd.Flags().Bool("show-effective", false, "Print the config in effect here, with project files applied, and where each setting came from")
 }
 
 var configCmd = &cobra.Command{
 	Use:   "/config",
 	Short: "Configure pal",
+	Long: `Configure pal.
+Without a subcommand, this asks about providers and settings one by one. The
+subcommands change the config without asking, for scripts.`,
+	Args: cobra.NoArgs,
 	RunE: func(cmd *cobra.Command, args []string) error {
+		if show, _ := cmd.Flags().GetBool("show-effective"); show {
+			return showEffectiveConfig(jsonOutput(cmd))
+		}
+
 		cfgPath, err := config.GetConfigPath()
 		if err != nil {
 			return fmt.Errorf("error getting config path: %v", err)
@@ -28,7 +40,11 @@ var configCmd = &cobra.Command{
 			return fmt.Errorf("error creating config directory: %v", err)
 		}
 
-		existingCfg, err := config.LoadConfig()
+		if profile, _ := config.ActiveProfile(); profile != config.DefaultProfile {
+			fmt.Printf("Configuring profile %s\n", profile)
+		}
+
+		existingCfg, err := config.LoadUserConfig()
 		// Check for configured providers
 		providers := make(map[string]config.Provider)
 
@@ -70,27 +86,28 @@ var configCmd = &cobra.Command{
 			}
 
 			selectedProvider := templates[choice-1]
+			existing, configured := providers[selectedProvider]
 
-			// Prompt for API key
-			var apiKey string
-			if err == nil && existingCfg != nil && existingCfg.Providers != nil {
-				provider, exists := existingCfg.Providers[selectedProvider]
-				if exists && provider.APIKey != "" {
-					fmt.Printf("Found existing API key for %s. Press enter to keep it, or enter a new one: ", selectedProvider)
-					fmt.Scanln(&apiKey)
-					if apiKey == "" {
-						apiKey = provider.APIKey
-					}
-				} else {
-					fmt.Printf("Enter your %s API key: ", selectedProvider)
-					fmt.Scanln(&apiKey)
-				}
-			} else {
-				fmt.Printf("Enter your %s API key: ", selectedProvider)
-				fmt.Scanln(&apiKey)
+			// Ollama runs locally and needs no API key
+			if config.ProviderTemplates[selectedProvider].Type == "ollama" {
+				providers[selectedProvider] = configureOllama(cmd, selectedProvider, existing, configured)
+				continue
+			}
+
+			// Azure needs the resource and deployments as well as the key
+			if selectedProvider == "azure" {
+				providers[selectedProvider] = configureAzure(selectedProvider, existing, configured)
+				continue
 			}
 
-			providers[selectedProvider] = config.NewProvider(selectedProvider, apiKey)
+			// Only the key changes, so settings like headers and prices are
+			// kept
+			provider := existing
+			if !configured {
+				provider = config.NewProvider(selectedProvider, "")
+			}
+			askAPIKey(selectedProvider, existing, &provider)
+			providers[selectedProvider] = provider
 		}
 
 		var prefix string
@@ -124,22 +141,22 @@ var configCmd = &cobra.Command{
 			formatMarkdown = markdownResponse == "y" || markdownResponse == "Y"
 		}
 
-		cfg := &config.Config{
-			Providers:          providers,
-			AbbreviationPrefix: prefix,
-			FormatMarkdown:     formatMarkdown,
+		// Start from the existing config, so that settings the wizard doesn't
+		// cover are kept
+		cfg := &config.Config{}
+		if existingCfg != nil {
+			*cfg = *existingCfg
 		}
+		cfg.Providers = providers
+		cfg.AbbreviationPrefix = prefix
+		cfg.FormatMarkdown = formatMarkdown
 
 		// If there's no model configured but there's a provider configured now,
 		// prompt the user to choose a model
-		if len(providers) > 0 {
-			if existingCfg != nil && existingCfg.SelectedModel != "" {
-				cfg.SelectedModel = existingCfg.SelectedModel
-			} else if existingCfg.SelectedModel == "" {
-				err = config.Models(cfg)
-				if err != nil {
-					return err
-				}
+		if len(providers) > 0 && cfg.SelectedModel == "" {
+			err = config.Models(cfg)
+			if err != nil {
+				return err
 			}
 		}
 
@@ -151,3 +168,258 @@ var configCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// configureOllama asks where Ollama is running and fills in the model list
+// with the models it has installed
+func configureOllama(cmd *cobra.Command, name string, existing config.Provider, configured bool) config.Provider {
+	// Only the URL and models change, so settings like options and params
+	// are kept
+	provider := existing
+	if !configured {
+		provider = config.NewProvider(name, "")
+	}
+
+	var url string
+	fmt.Printf("Enter the Ollama URL (default '%s'): ", provider.URL)
+	fmt.Scanln(&url)
+	if url != "" {
+		provider.URL = url
+	}
+
+	models, err := ai.ListModels(cmd.Context(), name, provider)
+	if err != nil {
+		fmt.Printf("Couldn't get the list of models from Ollama: %v\n", err)
+		fmt.Println("Make sure Ollama is running and run /config again, or add models to the config file by hand")
+		return provider
+	}
+	if len(models) == 0 {
+		fmt.Println("Ollama doesn't have any models installed yet. Pull one with 'ollama pull' and run /config again")
+		provider.Models = nil
+		provider.RefreshedModels = nil
+		return provider
+	}
+
+	fmt.Println("Found models:")
+	for _, model := range models {
+		fmt.Println(model)
+	}
+	provider.Models = models
+	// They all came from Ollama, so /models --refresh can remove them once
+	// they're deleted there
+	provider.RefreshedModels = models
+	return provider
+}
+
+// configureAzure asks for the Azure OpenAI resource, API key and deployments.
+// Azure addresses models by deployment name, so the deployments are the
+// models
+func configureAzure(name string, existing config.Provider, configured bool) config.Provider {
+	// Only what's asked about below changes, so settings like prices and
+	// params are kept
+	provider := existing
+	if !configured {
+		provider = config.NewProvider(name, "")
+	}
+
+	var resource string
+	if existing.URL != "" {
+		fmt.Printf("Enter your Azure OpenAI resource name or endpoint, or press enter to keep %s: ", existing.URL)
+	} else {
+		fmt.Print("Enter your Azure OpenAI resource name or endpoint: ")
+	}
+	fmt.Scanln(&resource)
+	if resource != "" {
+		provider.URL = azureURL(resource)
+	}
+
+	askAPIKey(name, existing, &provider)
+
+	var deployments string
+	if len(existing.Models) > 0 {
+		fmt.Printf("Enter your deployment names separated by commas, or press enter to keep %s: ", strings.Join(existing.Models, ","))
+	} else {
+		fmt.Print("Enter your deployment names separated by commas: ")
+	}
+	fmt.Scanln(&deployments)
+	if deployments != "" {
+		provider.Models = nil
+		for _, deployment := range strings.Split(deployments, ",") {
+			if deployment = strings.TrimSpace(deployment); deployment != "" {
+				provider.Models = append(provider.Models, deployment)
+			}
+		}
+	}
+	return provider
+}
+
+// azureURL returns the deployments URL for an Azure OpenAI resource, given as
+// a name like "mycompany" or an endpoint like
+// https://mycompany.openai.azure.com
+func azureURL(resource string) string {
+	if !strings.Contains(resource, "://") {
+		resource = "https://" + resource + ".openai.azure.com"
+	}
+	return strings.TrimSuffix(resource, "/") + "/openai/deployments/{model}/"
+}
+
+// askAPIKey asks how to get the provider's API key: typed in and kept in the
+// config file, or from an environment variable, a file or a command. Pressing
+// enter keeps the existing way
+func askAPIKey(name string, existing config.Provider, provider *config.Provider) {
+	if source := existing.KeySource(); source != "" {
+		fmt.Printf("The %s API key comes from the %s\n", name, source)
+	}
+	fmt.Printf("How should pal get the %s API key?\n", name)
+	fmt.Println("1. Enter it now, to keep it in the config file")
+	fmt.Println("2. From an environment variable")
+	fmt.Println("3. From a file")
+	fmt.Printf("4. From a command that prints it, like 'pass show %s'\n", name)
+	if existing.KeySource() != "" {
+		fmt.Print("Choose (1-4), or press enter to keep it: ")
+	} else {
+		fmt.Print("Choose (1-4, default 1): ")
+	}
+
+	var choice string
+	fmt.Scanln(&choice)
+	if choice == "" && existing.KeySource() != "" {
+		copyAPIKey(provider, existing)
+		return
+	}
+
+	*provider = withoutAPIKey(*provider)
+	switch choice {
+	case "2":
+		defaultEnv := strings.ToUpper(name) + "_API_KEY"
+		if existing.APIKeyEnv != "" {
+			defaultEnv = existing.APIKeyEnv
+		}
+		fmt.Printf("Enter the name of the environment variable (default %s): ", defaultEnv)
+		fmt.Scanln(&provider.APIKeyEnv)
+		if provider.APIKeyEnv == "" {
+			provider.APIKeyEnv = defaultEnv
+		}
+		if os.Getenv(provider.APIKeyEnv) == "" {
+			fmt.Printf("Note that %s isn't set in this shell\n", provider.APIKeyEnv)
+		}
+	case "3":
+		fmt.Print("Enter the path of the file: ")
+		provider.APIKeyFile = scanLine()
+	case "4":
+		fmt.Print("Enter the command: ")
+		provider.APIKeyCmd = scanLine()
+	default:
+		fmt.Printf("Enter your %s API key: ", name)
+		fmt.Scanln(&provider.APIKey)
+	}
+}
+
+// copyAPIKey sets the API key of provider, wherever it comes from, to that
+// of from
+func copyAPIKey(provider *config.Provider, from config.Provider) {
+	provider.APIKey = from.APIKey
+	provider.APIKeyEnv = from.APIKeyEnv
+	provider.APIKeyFile = from.APIKeyFile
+	provider.APIKeyCmd = from.APIKeyCmd
+}
+
+func withoutAPIKey(provider config.Provider) config.Provider {
+	provider.APIKey = ""
+	provider.APIKeyEnv = ""
+	provider.APIKeyFile = ""
+	provider.APIKeyCmd = ""
+	return provider
+}
+
+// scanLine reads a whole line from stdin, where fmt.Scanln stops at spaces.
+// Like fmt.Scanln, it reads a byte at a time, so the two can be mixed
+func scanLine() string {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := os.Stdin.Read(b)
+		if n == 0 || err != nil || b[0] == '\n' {
+			break
+		}
+		line = append(line, b[0])
+	}
+	return strings.TrimSpace(string(line))
+}
+
+// showEffectiveConfig prints the config with project files applied. Each
+// setting is marked with the file it came from, and API keys and headers
+// are hidden
+func showEffectiveConfig(asJSON bool) error {
+	cfg, sources, err := config.LoadEffectiveConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	cfgPath, err := config.GetConfigPath()
+	if err != nil {
+		return fmt.Errorf("error getting config path: %v", err)
+	}
+	projects, err := config.ProjectFiles()
+	if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err := doc.Encode(cfg); err != nil {
+		return fmt.Errorf("error encoding config: %w", err)
+	}
+	annotateSources(&doc, "", sources, cfgPath)
+
+	if asJSON {
+		var settings any
+		if err := doc.Decode(&settings); err != nil {
+			return err
+		}
+		return printJSON(map[string]any{"config": settings, "sources": sources})
+	}
+	fmt.Printf("# User config: %s\n", cfgPath)
+	for _, project := range projects {
+		fmt.Printf("# Project: %s\n", project)
+	}
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(&doc)
+}
+
+// annotateSources marks each setting with the file it came from and hides
+// the secrets. Providers' headers are hidden along with their API keys,
+// since they're how gateways are authenticated
+func annotateSources(node *yaml.Node, path string, sources config.Sources, userPath string) {
+	if node.Kind == yaml.DocumentNode {
+		annotateSources(node.Content[0], path, sources, userPath)
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		keyPath := key.Value
+		if path != "" {
+			keyPath = path + "." + key.Value
+		}
+		secret := key.Value == "api_key" || strings.HasPrefix(path, "providers.") && strings.HasSuffix(path, ".headers")
+		if secret && value.Value != "" {
+			value.Value = "<hidden>"
+		}
+		if value.Kind == yaml.MappingNode && len(value.Content) > 0 {
+			annotateSources(value, keyPath, sources, userPath)
+			continue
+		}
+
+		source := sources.Source(keyPath)
+		if source == "" {
+			continue
+		}
+		if source == userPath {
+			source = "user config"
+		}
+		if value.Kind == yaml.ScalarNode || len(value.Content) == 0 {
+			value.LineComment = source
+		} else {
+			key.LineComment = source
+		}
+	}
+}
@@ -0,0 +1,413 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/scottyeager/pal/ai"
+	"github.com/scottyeager/pal/config"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// The subcommands of /config change the config without asking anything, for
+// provisioning pal from scripts, Dockerfiles and the like
+
+func init() {
+	configCmd.PersistentFlags().Bool("json", false, "Print the result as JSON")
+	configCmd.AddCommand(configAddProviderCmd)
+	configCmd.AddCommand(configRemoveProviderCmd)
+	configCmd.AddCommand(configSetCmd)
+	configCmd.AddCommand(configGetCmd)
+
+	flags := configAddProviderCmd.Flags()
+	flags.String("key", "", "The API key, to keep in the config file")
+	flags.String("key-env", "", "Environment variable to read the API key from")
+	flags.String("key-file", "", "File to read the API key from")
+	flags.String("key-cmd", "", "Command that prints the API key, like 'pass show deepseek'")
+	flags.String("url", "", "The API's base URL. For azure, the resource name or endpoint")
+	flags.String("type", "", "The API type, for providers without a template: "+strings.Join(ai.BackendTypes(), ", "))
+	flags.StringSlice("models", nil, "Models to configure, separated by commas, instead of the template's")
+}
+
+var configAddProviderCmd = &cobra.Command{
+	Use:   "add-provider [name]",
+	Short: "Add a provider, or change one that's configured",
+	Long: `Add a provider, or change one that's configured.
+Providers with a template, like deepseek or anthropic, only need a way to
+get the API key. Others need --url, and usually --models. When no model is
+selected yet, the provider's first model is selected.`,
+	Args: cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return templateNames(), cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+		flags := cmd.Flags()
+		cfg, err := config.LoadUserConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+
+		existing, exists := cfg.Providers[name]
+		_, hasTemplate := config.ProviderTemplates[name]
+		url, _ := flags.GetString("url")
+		if !exists && !hasTemplate && url == "" {
+			return fmt.Errorf("There's no template for provider '%s'. Give its --url to add it anyway, or use one of: %s", name, strings.Join(templateNames(), ", "))
+		}
+
+		provider := existing
+		if !exists {
+			provider = config.NewProvider(name, "")
+		}
+		if flags.Changed("type") {
+			providerType, _ := flags.GetString("type")
+			if !slices.Contains(ai.BackendTypes(), providerType) {
+				return fmt.Errorf("Unknown type '%s'. Supported types are: %s", providerType, strings.Join(ai.BackendTypes(), ", "))
+			}
+			provider.Type = providerType
+		}
+		if url != "" {
+			if name == "azure" && !strings.Contains(url, "{model}") {
+				url = azureURL(url)
+			}
+			provider.URL = url
+		}
+		if provider.URL == "" || strings.Contains(provider.URL, "YOUR-RESOURCE") {
+			return fmt.Errorf("Provider %s needs a --url", name)
+		}
+
+		if flags.Changed("models") {
+			models, _ := flags.GetStringSlice("models")
+			provider.Models = nil
+			for _, model := range models {
+				if model = strings.TrimSpace(model); model != "" {
+					provider.Models = append(provider.Models, model)
+				}
+			}
+		} else if !exists && ai.ProviderType(name, provider) == "ollama" {
+			models, err := ai.ListModels(cmd.Context(), name, provider)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: couldn't get the list of models from Ollama: %v\n", err)
+			}
+			provider.Models = models
+			provider.RefreshedModels = models
+		}
+
+		keyFlags := []string{"key", "key-env", "key-file", "key-cmd"}
+		var keyFlag string
+		for _, flag := range keyFlags {
+			if flags.Changed(flag) {
+				if keyFlag != "" {
+					return fmt.Errorf("Give only one of --key, --key-env, --key-file and --key-cmd")
+				}
+				keyFlag = flag
+			}
+		}
+		if keyFlag != "" {
+			value, _ := flags.GetString(keyFlag)
+			provider = withoutAPIKey(provider)
+			switch keyFlag {
+			case "key":
+				provider.APIKey = value
+			case "key-env":
+				provider.APIKeyEnv = value
+			case "key-file":
+				provider.APIKeyFile = value
+			case "key-cmd":
+				provider.APIKeyCmd = value
+			}
+		}
+
+		if cfg.Providers == nil {
+			cfg.Providers = make(map[string]config.Provider)
+		}
+		cfg.Providers[name] = provider
+		selected := ""
+		if cfg.SelectedModel == "" && len(provider.Models) > 0 {
+			cfg.SelectedModel = name + "/" + provider.Models[0]
+			selected = cfg.SelectedModel
+		}
+		if err := config.CheckSettings(cfg); err != nil {
+			return err
+		}
+		cfgPath, err := saveConfig(cfg)
+		if err != nil {
+			return err
+		}
+
+		providerType := ai.ProviderType(name, provider)
+		if provider.KeySource() == "" && providerType != "ollama" && providerType != "mock" {
+			fmt.Fprintf(os.Stderr, "Note that %s has no API key yet. Give one with --key, --key-env, --key-file or --key-cmd\n", name)
+		}
+		if jsonOutput(cmd) {
+			return printJSON(providerResult{
+				Provider:      name,
+				Added:         !exists,
+				Type:          providerType,
+				URL:           provider.URL,
+				Models:        provider.Models,
+				KeySource:     provider.KeySource(),
+				SelectedModel: selected,
+				Config:        cfgPath,
+			})
+		}
+		if exists {
+			fmt.Printf("Updated provider %s", name)
+		} else {
+			fmt.Printf("Added provider %s", name)
+		}
+		fmt.Printf(" with models: %s\n", strings.Join(provider.Models, ", "))
+		if selected != "" {
+			fmt.Printf("Selected model: %s\n", selected)
+		}
+		return nil
+	},
+}
+
+type providerResult struct {
+	Provider      string   `json:"provider"`
+	Added         bool     `json:"added"`
+	Type          string   `json:"type"`
+	URL           string   `json:"url"`
+	Models        []string `json:"models"`
+	KeySource     string   `json:"key_source,omitempty"`
+	SelectedModel string   `json:"selected_model,omitempty"`
+	Config        string   `json:"config"`
+}
+
+var configRemoveProviderCmd = &cobra.Command{
+	Use:   "remove-provider [name...]",
+	Short: "Remove providers from the config",
+	Args:  cobra.MinimumNArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		cfg, err := config.LoadUserConfig()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		var names []string
+		for name := range cfg.Providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return names, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadUserConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		for _, name := range args {
+			provider, ok := cfg.Providers[name]
+			if !ok {
+				return fmt.Errorf("Provider '%s' isn't configured", name)
+			}
+			for _, model := range provider.Models {
+				if fullName := name + "/" + model; modelInUse(cfg, fullName) {
+					return fmt.Errorf("%s is selected or a fallback model. Choose another model first, like with 'pal /config set selected_model <model>'", fullName)
+				}
+			}
+			delete(cfg.Providers, name)
+		}
+		if err := config.CheckSettings(cfg); err != nil {
+			return err
+		}
+		cfgPath, err := saveConfig(cfg)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput(cmd) {
+			return printJSON(map[string]any{"removed": args, "config": cfgPath})
+		}
+		for _, name := range args {
+			fmt.Printf("Removed provider %s\n", name)
+		}
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set [key] [value]",
+	Short: "Change a setting in the config",
+	Long: `Change a setting in the config.
+Keys are paths of YAML keys separated by dots, like abbreviation_prefix or
+selected_models.commit. Values are read as YAML, so lists can be given like
+'[deepseek/deepseek-chat, anthropic/claude-3-5-haiku-latest]'.`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		key := args[0]
+		cfg, err := config.LoadUserConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+
+		var root yaml.Node
+		if err := root.Encode(cfg); err != nil {
+			return fmt.Errorf("error encoding config: %w", err)
+		}
+		value := parseValue(args[1])
+		if err := setPath(&root, strings.Split(key, "."), value); err != nil {
+			return err
+		}
+
+		// Decoding strictly catches unknown keys and values of the wrong type
+		data, err := yaml.Marshal(&root)
+		if err != nil {
+			return fmt.Errorf("error encoding config: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		var updated config.Config
+		if err := decoder.Decode(&updated); err != nil {
+			return fmt.Errorf("Can't set %s: %w", key, err)
+		}
+		if err := config.CheckSettings(&updated); err != nil {
+			return err
+		}
+		cfgPath, err := saveConfig(&updated)
+		if err != nil {
+			return err
+		}
+
+		if jsonOutput(cmd) {
+			var v any
+			if err := value.Decode(&v); err != nil {
+				return err
+			}
+			return printJSON(map[string]any{"key": key, "value": v, "config": cfgPath})
+		}
+		fmt.Printf("Set %s to %s\n", key, args[1])
+		return nil
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get [key]",
+	Short: "Print a setting from the config",
+	Long: `Print a setting from the config.
+Keys are paths of YAML keys separated by dots, like selected_model or
+providers.deepseek.models. This reads your own config file. To see the
+settings in effect with project files applied, use /config --show-effective.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadUserConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		var root yaml.Node
+		if err := root.Encode(cfg); err != nil {
+			return fmt.Errorf("error encoding config: %w", err)
+		}
+
+		node := &root
+		for _, key := range strings.Split(args[0], ".") {
+			if node = mappingValue(node, key); node == nil {
+				return fmt.Errorf("%s isn't set in the config", args[0])
+			}
+		}
+
+		if jsonOutput(cmd) {
+			var v any
+			if err := node.Decode(&v); err != nil {
+				return err
+			}
+			return printJSON(v)
+		}
+		if node.Kind == yaml.ScalarNode {
+			fmt.Println(node.Value)
+			return nil
+		}
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		defer encoder.Close()
+		return encoder.Encode(node)
+	},
+}
+
+func templateNames() []string {
+	names := make([]string, 0, len(config.ProviderTemplates))
+	for name := range config.ProviderTemplates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// saveConfig saves cfg to the config of the profile in use and returns its
+// path
+func saveConfig(cfg *config.Config) (string, error) {
+	cfgPath, err := config.GetConfigPath()
+	if err != nil {
+		return "", fmt.Errorf("error getting config path: %w", err)
+	}
+	if err := config.SaveConfig(cfg); err != nil {
+		return "", fmt.Errorf("error saving config: %w", err)
+	}
+	return cfgPath, nil
+}
+
+func jsonOutput(cmd *cobra.Command) bool {
+	asJSON, _ := cmd.Flags().GetBool("json")
+	return asJSON
+}
+
+func printJSON(v any) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+// parseValue reads a value given on the command line as YAML. Anything that
+// isn't valid YAML is taken as a string
+func parseValue(value string) *yaml.Node {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(value), &doc); err != nil || len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	}
+	return doc.Content[0]
+}
+
+// setPath sets the value at path in the mapping node, adding the maps on the
+// way that don't exist yet
+func setPath(node *yaml.Node, path []string, value *yaml.Node) error {
+	for i, key := range path {
+		if node.Kind != yaml.MappingNode {
+			return fmt.Errorf("Can't set %s, since %s isn't a map", strings.Join(path, "."), strings.Join(path[:i], "."))
+		}
+		next := mappingValue(node, key)
+		if i == len(path)-1 {
+			if next != nil {
+				*next = *value
+			} else {
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, value)
+			}
+			return nil
+		}
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key}, next)
+		} else if next.Kind == yaml.ScalarNode && next.Tag == "!!null" {
+			*next = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		node = next
+	}
+	return nil
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/scottyeager/pal/config"
+	"gopkg.in/yaml.v3"
+)
+
+func TestAnnotateSourcesHidesSecrets(t *testing.T) {
+	cfg := &config.Config{
+		Providers: map[string]config.Provider{
+			"gateway": {
+				URL:    "https://gateway.example.com/v1/",
+				APIKey: "sk-secret",
+				Headers: map[string]string{
+					"Authorization": "Bearer gw-token",
+					"X-Team-Key":    "team-key",
+				},
+			},
+		},
+	}
+	var doc yaml.Node
+	if err := doc.Encode(cfg); err != nil {
+		t.Fatal(err)
+	}
+	annotateSources(&doc, "", config.Sources{"providers": "/home/me/config.yaml"}, "/home/me/config.yaml")
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"sk-secret", "gw-token", "team-key"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("%q shown in:\n%s", secret, out)
+		}
+	}
+	if !strings.Contains(string(out), "https://gateway.example.com/v1/") || !strings.Contains(string(out), "Authorization: <hidden>") {
+		t.Errorf("settings missing from:\n%s", out)
+	}
+
+	// --json decodes the same node
+	var settings map[string]any
+	if err := doc.Decode(&settings); err != nil {
+		t.Fatal(err)
+	}
+	headers := settings["providers"].(map[string]any)["gateway"].(map[string]any)["headers"].(map[string]any)
+	if headers["X-Team-Key"] != "<hidden>" {
+		t.Errorf("headers = %v", headers)
+	}
+}
@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+
+	"github.com/scottyeager/pal/ai"
+	"github.com/scottyeager/pal/config"
+	"github.com/scottyeager/pal/inout"
+	"github.com/scottyeager/pal/prompts"
+	"github.com/spf13/cobra"
+)
+
+var validCommandName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// registerCustomCommands adds the slash commands defined in the config, so
+// they work like built in ones, with completion. A bad definition is only
+// warned about, so it can't keep pal from running
+func registerCustomCommands() {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return
+	}
+	for _, custom := range cfg.Commands {
+		if err := checkCustomCommand(custom); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: skipping custom command '%s' from the config: %v\n", custom.Name, err)
+			continue
+		}
+		rootCmd.AddCommand(newCustomCommand(custom))
+	}
+}
+
+func checkCustomCommand(custom config.CustomCommand) error {
+	if !validCommandName.MatchString(custom.Name) {
+		return fmt.Errorf("names can only have lowercase letters, numbers, dashes and underscores, without a leading slash")
+	}
+	for _, cmd := range rootCmd.Commands() {
+		if cmd.Name() == "/"+custom.Name {
+			return fmt.Errorf("there's already a /%s command", custom.Name)
+		}
+	}
+	if custom.Output != "" && !slices.Contains(config.OutputModes, custom.Output) {
+		return fmt.Errorf("output must be one of %s", strings.Join(config.OutputModes, ", "))
+	}
+	if _, err := template.New(custom.Name).Parse(custom.Prompt); err != nil {
+		return fmt.Errorf("error in prompt: %w", err)
+	}
+	return nil
+}
+
+func newCustomCommand(custom config.CustomCommand) *cobra.Command {
+	short := custom.Description
+	if short == "" {
+		short = "Custom command from your config"
+	}
+	return &cobra.Command{
+		Use:   "/" + custom.Name,
+		Short: short,
+		Annotations: map[string]string{
+			"takes_user_message": "true",
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runCustomCommand(cmd, custom)
+		},
+	}
+}
+
+func runCustomCommand(cmd *cobra.Command, custom config.CustomCommand) error {
+	var stdinInput string
+	if custom.Stdin {
+		var err error
+		stdinInput, err = inout.ReadStdin()
+		if err != nil {
+			return err
+		}
+	}
+	if len(userMessage) == 0 && stdinInput == "" {
+		return fmt.Errorf("No input detected. Please write or pipe in a query")
+	}
+	question := strings.Join(userMessage, " ")
+	if stdinInput != "" {
+		question = stdinInput + "\nThat concludes the stdin contents. Now here's the query from the user:\n" + question
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("error loading config: %w", err)
+	}
+	if err := config.CheckConfiguration(cfg); err != nil {
+		return err
+	}
+
+	aiClient, err := ai.NewCommandClient(cfg, custom.CommandKey())
+	if err != nil {
+		return fmt.Errorf("error creating AI client: %w", err)
+	}
+
+	// The built in prompt that {{.Default}} refers to is the one of the
+	// command with the same kind of output
+	output := custom.Output
+	if output == "" {
+		output = "plain"
+	}
+	var base string
+	switch output {
+	case "cmd":
+		base = defaultPrompt(cfg, "cmd")
+	case "file":
+		base = defaultPrompt(cfg, "file")
+	default:
+		base = defaultPrompt(cfg, "ask")
+	}
+	system_prompt := base
+	if custom.Prompt != "" {
+		system_prompt, err = prompts.Expand(custom.Prompt, prompts.NewData(custom.Name, base))
+		if err != nil {
+			return fmt.Errorf("error in the prompt of /%s: %w", custom.Name, err)
+		}
+	}
+
+	t := 1.0
+	if output == "cmd" {
+		t = 0.0
+	}
+	if custom.Temperature != nil {
+		t = *custom.Temperature
+	}
+	if cmd.Flags().Changed("temperature") {
+		t = temperature
+	}
+
+	switch output {
+	case "cmd":
+		response, err := aiClient.GetJSON(cmd.Context(), system_prompt, question, t, suggestionSchema)
+		if err != nil {
+			return fmt.Errorf("error getting completion: %w", err)
+		}
+		result, err := parseSuggestions(response)
+		if err != nil {
+			return err
+		}
+		if err := storeSuggestions(result); err != nil {
+			return fmt.Errorf("error getting completion: failed to write to disk: %w", err)
+		}
+		printSuggestions(result)
+	case "file":
+		printer := ai.NewStreamPrinter(os.Stdout, false)
+		response, err := aiClient.StreamCompletion(cmd.Context(), system_prompt, question, t, printer.Write)
+		if err != nil {
+			return fmt.Errorf("error getting completion: %w", err)
+		}
+		printer.Finish(sanitizeFileContent(response))
+	default:
+		printer := ai.NewStreamPrinter(os.Stdout, output == "markdown")
+		response, err := aiClient.StreamCompletion(cmd.Context(), system_prompt, question, t, printer.Write)
+		if err != nil {
+			return fmt.Errorf("error getting completion: %w", err)
+		}
+		printer.Finish(response)
+	}
+	return nil
+}
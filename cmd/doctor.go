@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/scottyeager/pal/ai"
+	"github.com/scottyeager/pal/config"
+	"github.com/scottyeager/pal/inout"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+	doctorCmd.Flags().Bool("offline", false, "Skip sending test requests to the providers")
+}
+
+var doctorCmd = &cobra.Command{
+	Use:   "/doctor",
+	Short: "Check the config, shell integration and providers for problems",
+	Long: `Check the config, shell integration and providers for problems.
+Each configured provider is sent a tiny test request, which counts toward
+your usage with it.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		offline, _ := cmd.Flags().GetBool("offline")
+
+		cfg, checks := checkConfig()
+		checks = append(checks, checkExpansionsFile())
+		checks = append(checks, checkShellWidget(cfg))
+		if cfg != nil && !offline {
+			checks = append(checks, checkProviders(cmd.Context(), cfg)...)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "check\tstatus\tdetails")
+		failed := 0
+		for _, c := range checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.name, c.status, c.details)
+			if c.status == checkFail {
+				failed++
+			}
+		}
+		w.Flush()
+
+		printedHeader := false
+		for _, c := range checks {
+			if c.hint == "" {
+				continue
+			}
+			if !printedHeader {
+				fmt.Println("\nHow to fix:")
+				printedHeader = true
+			}
+			fmt.Printf("- %s: %s\n", c.name, c.hint)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+		}
+		return nil
+	},
+}
+
+const (
+	checkOK   = "ok"
+	checkWarn = "warn"
+	checkFail = "FAIL"
+)
+
+// check is a row of the /doctor table
+type check struct {
+	name    string
+	status  string
+	details string
+	// What to do about a warning or failure
+	hint string
+}
+
+// checkConfig loads the config in effect and checks it. The config is nil
+// when it can't be loaded
+func checkConfig() (*config.Config, []check) {
+	c := check{name: "config"}
+	cfgPath, err := config.GetConfigPath()
+	if err != nil {
+		c.status, c.details = checkFail, err.Error()
+		c.hint = "Set HOME or XDG_DATA_HOME, so pal can find its config directory"
+		return nil, []check{c}
+	}
+
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		c.status, c.details = checkFail, err.Error()
+		c.hint = fmt.Sprintf("Fix the YAML in %s, or in the project's %s", cfgPath, config.ProjectFileName)
+		return nil, []check{c}
+	}
+
+	c.status, c.details = checkOK, cfgPath
+	if profile, _ := config.ActiveProfile(); profile != config.DefaultProfile {
+		c.details += fmt.Sprintf(" (profile %s)", profile)
+	}
+	if err := config.CheckConfiguration(cfg); err != nil {
+		c.status, c.details = checkFail, err.Error()
+		c.hint = "Run 'pal /config' to set up providers, and 'pal /models' to select a model"
+	}
+	checks := []check{c}
+
+	for name, provider := range cfg.Providers {
+		if provider.APIKey != "" && config.WorldReadable(cfgPath) {
+			checks = append(checks, check{
+				name:    "config permissions",
+				status:  checkWarn,
+				details: "others can read the API keys in " + cfgPath,
+				hint:    fmt.Sprintf("Run 'chmod 600 %s', or read the %s key from elsewhere with 'pal /config add-provider %s --key-env VAR'", cfgPath, name, name),
+			})
+			break
+		}
+	}
+	return cfg, checks
+}
+
+// checkExpansionsFile checks that the expansions file can be read and
+// replaced. pal writes it by renaming a new file over it, so the directory
+// has to be writable as well
+func checkExpansionsFile() check {
+	c := check{name: "expansions file"}
+	path, err := inout.ExpansionsPath()
+	if err != nil {
+		c.status, c.details = checkFail, err.Error()
+		c.hint = "Set HOME or XDG_DATA_HOME, which the abbreviation scripts use to find the file"
+		return c
+	}
+	c.details = path
+
+	if shellPath := os.Getenv("PAL_ABBR_FILE"); shellPath != "" && shellPath != path {
+		c.status = checkFail
+		c.details = fmt.Sprintf("the shell reads %s, but pal writes %s", shellPath, path)
+		c.hint = "XDG_DATA_HOME changed since the shell loaded the abbreviations. Open a new shell"
+		return c
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		c.status, c.details = checkFail, err.Error()
+		c.hint = fmt.Sprintf("Make sure you can create %s", filepath.Dir(path))
+		return c
+	}
+	f, err := os.Open(path)
+	if err == nil {
+		f.Close()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		c.status, c.details = checkFail, err.Error()
+		c.hint = fmt.Sprintf("Run 'chmod u+rw %s', and chown it if it belongs to another user", path)
+		return c
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".doctor-*")
+	if err != nil {
+		c.status, c.details = checkFail, err.Error()
+		c.hint = fmt.Sprintf("Run 'chmod u+rwx %s', and chown it if it belongs to another user", filepath.Dir(path))
+		return c
+	}
+	tmp.Close()
+	os.Remove(tmp.Name())
+
+	c.status = checkOK
+	return c
+}
+
+// checkShellWidget looks for the variables the abbreviation scripts export,
+// since pal can't see into the shell that runs it
+func checkShellWidget(cfg *config.Config) check {
+	c := check{name: "shell abbreviations"}
+	shell := filepath.Base(os.Getenv("SHELL"))
+	prefix := os.Getenv("PAL_ABBR_PREFIX")
+	if os.Getenv("PAL_ABBR_FILE") == "" {
+		c.status, c.details = checkFail, "not loaded in this shell"
+		switch shell {
+		case "fish":
+			c.hint = "Run 'pal --fish-config >> ~/.config/fish/config.fish', then open a new shell"
+		case "zsh":
+			c.hint = "Run 'pal --zsh-config >> ~/.zshrc', then open a new shell"
+		default:
+			c.hint = "Abbreviations only work in fish and zsh. Set one of them up with 'pal --fish-config' or 'pal --zsh-config'"
+		}
+		return c
+	}
+
+	c.status, c.details = checkOK, fmt.Sprintf("loaded with prefix '%s'", prefix)
+	if cfg != nil && cfg.AbbreviationPrefix != "" && prefix != cfg.AbbreviationPrefix {
+		c.status = checkWarn
+		c.details = fmt.Sprintf("loaded with prefix '%s', but the config has '%s'", prefix, cfg.AbbreviationPrefix)
+		c.hint = "Open a new shell to use the prefix from the config"
+	}
+	return c
+}
+
+// checkProviders sends a test request to every provider at once, using the
+// selected model where it's one of the provider's
+func checkProviders(ctx context.Context, cfg *config.Config) []check {
+	names := make([]string, 0, len(cfg.Providers))
+	for name := range cfg.Providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	timeout := 30 * time.Second
+	if ai.Timeout > 0 {
+		timeout = ai.Timeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	checks := make([]check, len(names))
+	done := make(chan struct{})
+	for i, name := range names {
+		go func(c *check, name string) {
+			defer func() { done <- struct{}{} }()
+			*c = checkProvider(ctx, cfg, name, timeout)
+		}(&checks[i], name)
+	}
+	for range names {
+		<-done
+	}
+	return checks
+}
+
+func checkProvider(ctx context.Context, cfg *config.Config, name string, timeout time.Duration) check {
+	c := check{name: "provider " + name}
+	provider := cfg.Providers[name]
+	if len(provider.Models) == 0 {
+		c.status, c.details = checkFail, "no models configured"
+		c.hint = fmt.Sprintf("Run 'pal /models --refresh', or 'pal /config add-provider %s --models <model>'", name)
+		return c
+	}
+	model := provider.Models[0]
+	for _, m := range provider.Models {
+		if name+"/"+m == cfg.SelectedModel {
+			model = m
+		}
+	}
+
+	if provider.Timeout > 0 && provider.Timeout < timeout {
+		timeout = provider.Timeout
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	latency, err := ai.Ping(ctx, cfg, name, model)
+	var keyErr *ai.APIKeyError
+	switch {
+	case err == nil:
+		c.status = checkOK
+		c.details = fmt.Sprintf("%s answered in %s", model, latency.Round(time.Millisecond))
+	case errors.As(err, &keyErr):
+		c.status = checkFail
+		c.details, _, _ = strings.Cut(err.Error(), "\n")
+		c.hint = fmt.Sprintf("Fix the %s that the key comes from, or change it with 'pal /config add-provider %s --key-env VAR'", provider.KeySource(), name)
+	case ai.StatusCode(err) == http.StatusUnauthorized || ai.StatusCode(err) == http.StatusForbidden:
+		c.status = checkFail
+		c.details = fmt.Sprintf("%s: %s", model, ai.SummarizeError(err))
+		if source := provider.KeySource(); source != "" {
+			c.hint = fmt.Sprintf("The API key from the %s was turned down. Set a valid one with 'pal /config add-provider %s --key-env VAR'", source, name)
+		} else {
+			c.hint = fmt.Sprintf("There's no API key. Add one with 'pal /config add-provider %s --key-env VAR'", name)
+		}
+	case ai.StatusCode(err) >= 500:
+		c.status = checkFail
+		c.details = fmt.Sprintf("%s: %s", model, ai.SummarizeError(err))
+		c.hint = "The provider is having trouble. Try again later, or check its status page"
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		c.status = checkFail
+		c.details = fmt.Sprintf("%s: no response within %s", model, timeout)
+		c.hint = fmt.Sprintf("Check that %s can be reached, and the proxy settings if you need one", provider.URL)
+	default:
+		c.status = checkFail
+		c.details = fmt.Sprintf("%s: %s", model, ai.SummarizeError(err))
+		c.hint = fmt.Sprintf("Check the provider's url (%s) and that %s is one of its models", provider.URL, model)
+	}
+	return c
+}
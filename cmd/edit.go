@@ -1,7 +1,6 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -9,6 +8,7 @@ import (
 
 	"github.com/scottyeager/pal/ai"
 	"github.com/scottyeager/pal/config"
+	"github.com/scottyeager/pal/inout"
 	"github.com/spf13/cobra"
 )
 
@@ -66,6 +66,15 @@ The prompt can also be included in the contents of one or more files.`,
 			return nil
 		}
 
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+
+		if err := config.CheckConfiguration(cfg); err != nil {
+			return err
+		}
+
 		var filePaths []string
 		var promptParts []string
 
@@ -91,11 +100,14 @@ The prompt can also be included in the contents of one or more files.`,
 						return err
 					}
 					if info.IsDir() {
-						if info.Name() == ".git" {
+						if info.Name() == ".git" || (p != path && cfg.Edit.Ignored(p, true)) {
 							return filepath.SkipDir
 						}
 						return nil
 					}
+					if cfg.Edit.Ignored(p, false) {
+						return nil
+					}
 					allFiles = append(allFiles, p)
 					return nil
 				})
@@ -122,34 +134,47 @@ The prompt can also be included in the contents of one or more files.`,
 
 		finalPrompt := formattedFilesContent.String() + userPrompt
 
-		cfg, err := config.LoadConfig()
+		editModel := config.GetSelectedModel(cfg, "edit")
+		editPrompt, err := systemPrompt(cfg, "edit")
 		if err != nil {
-			return fmt.Errorf("error loading config: %w", err)
-		}
-
-		if err := config.CheckConfiguration(cfg); err != nil {
 			return err
 		}
 
-		editModel := config.GetSelectedModel(cfg, "edit")
-
-		client, err := ai.NewClient(cfg, editModel)
+		client, err := ai.NewCommandClient(cfg, "edit")
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error creating AI client: %v\n", err)
 			os.Exit(1)
 		}
 
-		response, err := client.GetCompletion(context.Background(), editSystemPrompt, finalPrompt, false, 1.0, false, editModel)
+		yoloMode, _ := cmd.Flags().GetBool("yolo")
+
+		// Outside of yolo mode the response is shown to the user, so stream it
+		var response string
+		var printer *ai.StreamPrinter
+		if yoloMode {
+			response, err = client.GetCompletion(cmd.Context(), editPrompt, finalPrompt, false, 1.0, false, editModel)
+		} else {
+			printer = ai.NewStreamPrinter(os.Stdout, false)
+			response, err = client.StreamCompletion(cmd.Context(), editPrompt, finalPrompt, 1.0, printer.Write)
+		}
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "Error getting completion: %v\n", err)
 			os.Exit(1)
 		}
 
-		yoloMode, _ := cmd.Flags().GetBool("yolo")
-
 		if yoloMode {
 			// Get model for apply command
 			applyModel := config.GetSelectedModel(cfg, "apply")
+			applyClient, err := ai.NewCommandClient(cfg, "apply")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error creating AI client: %v\n", err)
+				os.Exit(1)
+			}
+
+			applyPrompt, err := systemPrompt(cfg, "apply")
+			if err != nil {
+				return err
+			}
 
 			edits, parseErr := parseEdits(response)
 			if parseErr != nil {
@@ -164,7 +189,7 @@ The prompt can also be included in the contents of one or more files.`,
 
 			appliedCount := 0
 			for _, edit := range edits {
-				err := applyEdit(client, edit, applyModel)
+				err := applyEdit(cmd.Context(), applyClient, applyPrompt, edit, applyModel)
 				if err != nil {
 					fmt.Fprintf(os.Stderr, "Error applying edit to %s in yolo mode: %v\n", edit.FilePath, err)
 					continue
@@ -180,11 +205,11 @@ The prompt can also be included in the contents of one or more files.`,
 				os.Exit(1)
 			}
 
-			if err := os.WriteFile(filePath, []byte(response), 0644); err != nil {
+			if err := inout.WriteFileAtomic(filePath, []byte(response), 0644); err != nil {
 				fmt.Fprintf(os.Stderr, "Error writing response to file %s: %v\n", filePath, err)
 				os.Exit(1)
 			}
-			fmt.Println(response)
+			printer.Finish(response)
 		}
 		return nil
 	},
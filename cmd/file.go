@@ -1,8 +1,8 @@
 package cmd
 
 import (
-	"context"
 	"fmt"
+	"os"
 	"strings"
 
 	"github.com/scottyeager/pal/ai"
@@ -34,9 +34,7 @@ var fileCmd = &cobra.Command{
 			return err
 		}
 
-		fileModel := config.GetSelectedModel(cfg, "file")
-		aiClient, err := ai.NewClient(cfg, fileModel)
-
+		aiClient, err := ai.NewCommandClient(cfg, "file")
 		if err != nil {
 			return fmt.Errorf("error creating AI client: %w", err)
 		}
@@ -52,24 +50,30 @@ var fileCmd = &cobra.Command{
 			description = strings.Join(args, " ")
 		}
 
-		system_prompt := "You are a helpful assistant that generates file contents. Provide only the raw file content without any additional commentary, explanations, or markdown formatting. Do not wrap the content in code blocks (```)."
+		system_prompt, err := systemPrompt(cfg, "file")
+		if err != nil {
+			return err
+		}
 
 		t := 1.0
 		if cmd.Flags().Changed("temperature") {
 			t = temperature
 		}
 
-		response, err := aiClient.GetCompletion(context.Background(), system_prompt, description, false, t, false, fileModel)
+		// The streamed text is replaced by the sanitized version at the end
+		printer := ai.NewStreamPrinter(os.Stdout, false)
+		response, err := aiClient.StreamCompletion(cmd.Context(), system_prompt, description, t, printer.Write)
 		if err != nil {
 			return fmt.Errorf("error getting completion: %w", err)
 		}
 
-		content := sanitizeFileContent(response)
-		fmt.Println(content)
+		printer.Finish(sanitizeFileContent(response))
 		return nil
 	},
 }
 
+const fileSystemPrompt = "You are a helpful assistant that generates file contents. Provide only the raw file content without any additional commentary, explanations, or markdown formatting. Do not wrap the content in code blocks (```)."
+
 func sanitizeFileContent(input string) string {
 	// Strip markdown code block delimiters and any language specifier
 	lines := strings.Split(input, "\n")
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/scottyeager/pal/config"
 	"github.com/spf13/cobra"
@@ -30,13 +31,17 @@ var modelCmd = &cobra.Command{
 		return models, cobra.ShellCompDirectiveNoFileComp
 	},
 	RunE: func(cmd *cobra.Command, args []string) error {
-		cfg, err := config.LoadConfig()
+		effective, sources, err := config.LoadEffectiveConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		cfg, err := config.LoadUserConfig()
 		if err != nil {
 			return fmt.Errorf("error loading config: %w", err)
 		}
 
 		if len(args) == 0 {
-			fmt.Printf("Currently selected model: %s\n", cfg.SelectedModel)
+			fmt.Printf("Currently selected model: %s\n", effective.SelectedModel)
 			return nil
 		}
 
@@ -65,6 +70,9 @@ var modelCmd = &cobra.Command{
 		}
 
 		fmt.Printf("Switched to model: %s\n", args[0])
+		if project, _ := config.ProjectFiles(); slices.Contains(project, sources["selected_model"]) {
+			fmt.Printf("Note that %s selects %s for this project\n", sources["selected_model"], effective.SelectedModel)
+		}
 		return nil
 	},
 }
@@ -1,24 +1,56 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/scottyeager/pal/ai"
 	"github.com/scottyeager/pal/config"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func init() {
 	rootCmd.AddCommand(modelsCmd)
+	modelsCmd.Flags().Bool("refresh", false, "Update the model lists of the given providers, or all of them, from their models endpoints")
+	modelsCmd.Flags().BoolP("yes", "y", false, "With --refresh, make all the changes without asking")
 }
 
 var modelsCmd = &cobra.Command{
-	Use:   "/models",
+	Use:   "/models [--refresh [provider...]]",
 	Short: "View and select models",
-	RunE: func(cmd *cobra.Command, args []string) error {
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
 		cfg, err := config.LoadConfig()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		var providers []string
+		for name := range cfg.Providers {
+			if !slices.Contains(args, name) {
+				providers = append(providers, name)
+			}
+		}
+		return providers, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadUserConfig()
 		if err != nil {
 			return fmt.Errorf("error loading config: %w", err)
 		}
+
+		if refresh, _ := cmd.Flags().GetBool("refresh"); refresh {
+			yes, _ := cmd.Flags().GetBool("yes")
+			return refreshModels(cmd, cfg, args, yes)
+		}
+		if len(args) > 0 {
+			return fmt.Errorf("providers can only be given with --refresh")
+		}
+
 		err = config.Models(cfg)
 		if err != nil {
 			return fmt.Errorf("error setting model: %w", err)
@@ -26,3 +58,202 @@ var modelsCmd = &cobra.Command{
 		return nil
 	},
 }
+
+// modelChanges is what a refresh would change about a provider's models
+type modelChanges struct {
+	Added   []string
+	Removed []string
+	// Models that aren't listed anymore but stay, because they were added
+	// by hand or are in use
+	Manual []string
+	InUse  []string
+}
+
+func (c modelChanges) empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0
+}
+
+// diffModels compares a provider's configured models with those its API
+// lists. Models that came from the template or an earlier refresh are
+// removed when they're gone from the list, but models added by hand and
+// models that are selected are always kept
+func diffModels(cfg *config.Config, name string, provider config.Provider, listed []string) modelChanges {
+	var changes modelChanges
+	for _, model := range listed {
+		if !slices.Contains(provider.Models, model) && !slices.Contains(changes.Added, model) {
+			changes.Added = append(changes.Added, model)
+		}
+	}
+	sort.Strings(changes.Added)
+
+	managed := append(slices.Clone(config.ProviderTemplates[name].Models), provider.RefreshedModels...)
+	for _, model := range provider.Models {
+		switch {
+		case slices.Contains(listed, model):
+		case !slices.Contains(managed, model):
+			changes.Manual = append(changes.Manual, model)
+		case modelInUse(cfg, name+"/"+model):
+			changes.InUse = append(changes.InUse, model)
+		default:
+			changes.Removed = append(changes.Removed, model)
+		}
+	}
+	return changes
+}
+
+// modelInUse reports whether the model is selected or a fallback for any
+// command, so it can't be removed without breaking the config
+func modelInUse(cfg *config.Config, fullName string) bool {
+	if cfg.SelectedModel == fullName || slices.Contains(cfg.FallbackModels, fullName) {
+		return true
+	}
+	for _, model := range cfg.SelectedModels {
+		if model == fullName {
+			return true
+		}
+	}
+	for _, models := range cfg.CommandFallbackModels {
+		if slices.Contains(models, fullName) {
+			return true
+		}
+	}
+	return false
+}
+
+// applyModelChanges adds and removes the given models, keeping the order of
+// the ones that stay
+func applyModelChanges(provider config.Provider, added []string, removed []string) config.Provider {
+	var models []string
+	for _, model := range provider.Models {
+		if !slices.Contains(removed, model) {
+			models = append(models, model)
+		}
+	}
+	provider.Models = append(models, added...)
+
+	var refreshed []string
+	for _, model := range append(provider.RefreshedModels, added...) {
+		if !slices.Contains(removed, model) && !slices.Contains(refreshed, model) {
+			refreshed = append(refreshed, model)
+		}
+	}
+	provider.RefreshedModels = refreshed
+
+	if len(provider.Vision) > 0 {
+		provider.Vision = slices.DeleteFunc(slices.Clone(provider.Vision), func(model string) bool {
+			return slices.Contains(removed, model)
+		})
+	}
+	return provider
+}
+
+func refreshModels(cmd *cobra.Command, cfg *config.Config, names []string, yes bool) error {
+	if len(cfg.Providers) == 0 {
+		return fmt.Errorf("No providers configured. Run 'pal /config' to set up a provider")
+	}
+	explicit := len(names) > 0
+	if !explicit {
+		for name := range cfg.Providers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+	for _, name := range names {
+		if _, ok := cfg.Providers[name]; !ok {
+			return fmt.Errorf("provider '%s' not found in config", name)
+		}
+	}
+
+	interactive := !yes && term.IsTerminal(int(os.Stdin.Fd()))
+	reader := bufio.NewReader(os.Stdin)
+	changed := false
+	for _, name := range names {
+		provider := cfg.Providers[name]
+		lookup := provider
+		lookup.Network = lookup.Network.Or(cfg.Network)
+		if !ai.CanListModels(name, lookup) {
+			if explicit {
+				fmt.Printf("%s: listing models isn't supported for providers of type %s\n", name, ai.ProviderType(name, provider))
+			}
+			continue
+		}
+
+		listed, err := ai.ListModels(cmd.Context(), name, lookup)
+		if err != nil {
+			fmt.Printf("%s: %v\n", name, err)
+			continue
+		}
+		changes := diffModels(cfg, name, provider, listed)
+		printModelChanges(name, changes)
+		if changes.empty() {
+			continue
+		}
+
+		added, removed := changes.Added, changes.Removed
+		if !yes {
+			if !interactive {
+				fmt.Println("Run with --yes to make these changes")
+				continue
+			}
+			added, removed = pickModelChanges(reader, changes)
+		}
+		if len(added) == 0 && len(removed) == 0 {
+			continue
+		}
+		cfg.Providers[name] = applyModelChanges(provider, added, removed)
+		changed = true
+		fmt.Printf("%s: added %d, removed %d\n", name, len(added), len(removed))
+	}
+
+	if !changed {
+		return nil
+	}
+	if err := config.SaveConfig(cfg); err != nil {
+		return fmt.Errorf("error saving config: %w", err)
+	}
+	return nil
+}
+
+// printModelChanges shows the diff, numbering the changes so they can be
+// picked
+func printModelChanges(name string, changes modelChanges) {
+	if changes.empty() {
+		fmt.Printf("%s: up to date\n", name)
+	} else {
+		fmt.Printf("%s: %d new, %d no longer listed\n", name, len(changes.Added), len(changes.Removed))
+	}
+	for i, model := range changes.Added {
+		fmt.Printf("  %d. + %s\n", i+1, model)
+	}
+	for i, model := range changes.Removed {
+		fmt.Printf("  %d. - %s\n", len(changes.Added)+i+1, model)
+	}
+	if len(changes.Manual) > 0 {
+		fmt.Printf("  Not listed, but kept since they were added by hand: %s\n", strings.Join(changes.Manual, ", "))
+	}
+	if len(changes.InUse) > 0 {
+		fmt.Printf("  Not listed, but kept since they're selected: %s\n", strings.Join(changes.InUse, ", "))
+	}
+}
+
+// pickModelChanges asks which of the numbered changes to make
+func pickModelChanges(reader *bufio.Reader, changes modelChanges) (added []string, removed []string) {
+	fmt.Print("Enter the numbers of the changes to make, like 1 3 4, 'all', or press enter for none: ")
+	line, _ := reader.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "all" {
+		return changes.Added, changes.Removed
+	}
+	for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' }) {
+		n, err := strconv.Atoi(field)
+		switch {
+		case err != nil || n < 1 || n > len(changes.Added)+len(changes.Removed):
+			fmt.Printf("Skipping '%s', which isn't one of the numbers\n", field)
+		case n <= len(changes.Added):
+			added = append(added, changes.Added[n-1])
+		default:
+			removed = append(removed, changes.Removed[n-len(changes.Added)-1])
+		}
+	}
+	return added, removed
+}
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/scottyeager/pal/config"
+)
+
+func TestDiffModels(t *testing.T) {
+	template := config.ProviderTemplates["openai"].Models
+	if len(template) < 4 {
+		t.Fatalf("the openai template needs at least 4 models for this test, has %v", template)
+	}
+	selected := template[len(template)-1]
+	cfg := &config.Config{SelectedModel: "openai/" + selected}
+	provider := config.NewProvider("openai", "key")
+	provider.Models = append(provider.Models, "ft:gpt-4o:me", "refreshed-model")
+	provider.RefreshedModels = []string{"refreshed-model"}
+	provider.Vision = []string{template[0], template[2]}
+
+	listed := []string{template[0], template[1], "new-model", template[0]}
+	changes := diffModels(cfg, "openai", provider, listed)
+
+	if want := []string{"new-model"}; !reflect.DeepEqual(changes.Added, want) {
+		t.Errorf("added = %v, want %v", changes.Added, want)
+	}
+	// Template models and earlier refreshes go, unless they're selected
+	wantRemoved := append(slices.Clone(template[2:len(template)-1]), "refreshed-model")
+	if !reflect.DeepEqual(changes.Removed, wantRemoved) {
+		t.Errorf("removed = %v, want %v", changes.Removed, wantRemoved)
+	}
+	if want := []string{selected}; !reflect.DeepEqual(changes.InUse, want) {
+		t.Errorf("in use = %v, want %v", changes.InUse, want)
+	}
+	if want := []string{"ft:gpt-4o:me"}; !reflect.DeepEqual(changes.Manual, want) {
+		t.Errorf("manual = %v, want %v", changes.Manual, want)
+	}
+
+	updated := applyModelChanges(provider, []string{"new-model"}, []string{template[2], "refreshed-model"})
+	wantModels := append(slices.Concat(template[:2], template[3:]), "ft:gpt-4o:me", "new-model")
+	if !reflect.DeepEqual(updated.Models, wantModels) {
+		t.Errorf("models = %v, want %v", updated.Models, wantModels)
+	}
+	if want := []string{"new-model"}; !reflect.DeepEqual(updated.RefreshedModels, want) {
+		t.Errorf("refreshed = %v, want %v", updated.RefreshedModels, want)
+	}
+	if want := []string{template[0]}; !reflect.DeepEqual(updated.Vision, want) {
+		t.Errorf("vision = %v, want %v", updated.Vision, want)
+	}
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/scottyeager/pal/config"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(profileCmd)
+	profileCmd.AddCommand(profileUseCmd)
+}
+
+var profileCmd = &cobra.Command{
+	Use:   "/profile",
+	Short: "List config profiles and show which is in use",
+	Long: `List config profiles and show which is in use.
+Each profile has its own providers, selected models and prompts. Create one
+with 'pal --profile work /config', and switch to it with 'pal /profile use
+work', or for a single shell with 'export PAL_PROFILE=work'.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profiles, err := config.Profiles()
+		if err != nil {
+			return err
+		}
+		active, source := config.ActiveProfile()
+		for _, profile := range profiles {
+			if profile == active {
+				fmt.Printf("* %s\n", profile)
+			} else {
+				fmt.Printf("  %s\n", profile)
+			}
+		}
+		if !slices.Contains(profiles, active) {
+			fmt.Printf("* %s (not set up yet, run 'pal /config')\n", active)
+		}
+		if source != "" {
+			fmt.Printf("\n%s is chosen by %s\n", active, source)
+		}
+		return nil
+	},
+}
+
+var profileUseCmd = &cobra.Command{
+	Use:   "use [profile]",
+	Short: "Switch to a profile",
+	Args:  cobra.ExactArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		profiles, err := config.Profiles()
+		if err != nil {
+			return nil, cobra.ShellCompDirectiveError
+		}
+		return profiles, cobra.ShellCompDirectiveNoFileComp
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		profile := args[0]
+		if err := config.CheckProfileName(profile); err != nil {
+			return err
+		}
+		profiles, err := config.Profiles()
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(profiles, profile) {
+			return fmt.Errorf("There's no profile named %s. Create it with 'pal --profile %s /config'", profile, profile)
+		}
+
+		if err := config.UseProfile(profile); err != nil {
+			return err
+		}
+		fmt.Printf("Switched to profile %s\n", profile)
+		if env := os.Getenv("PAL_PROFILE"); env != "" && env != profile {
+			fmt.Printf("PAL_PROFILE is set to %s in this shell, which takes precedence\n", env)
+		}
+		return nil
+	},
+}
@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scottyeager/pal/config"
+	"github.com/scottyeager/pal/prompts"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(promptsCmd)
+	promptsCmd.AddCommand(promptsShowCmd)
+	promptsCmd.AddCommand(promptsResetCmd)
+	promptsShowCmd.Flags().Bool("default", false, "Show the built in prompt, even if you have a template")
+}
+
+// promptCommands are the command keys whose system prompt can be replaced
+// with a template
+var promptCommands = []string{"cmd", "ask", "edit", "apply", "commit", "file"}
+
+// defaultPrompt returns the built in system prompt for a command key
+func defaultPrompt(cfg *config.Config, command string) string {
+	switch command {
+	case "cmd":
+		return cmdSystemPrompt
+	case "ask":
+		return askSystemPrompt(cfg)
+	case "edit":
+		return editSystemPrompt
+	case "apply":
+		return applySystemPrompt
+	case "commit":
+		return commitSystemPrompt
+	case "file":
+		return fileSystemPrompt
+	}
+	return ""
+}
+
+// systemPrompt returns the system prompt for a command key, from the prompts
+// in the config or the user's template if there is one
+func systemPrompt(cfg *config.Config, command string) (string, error) {
+	prompt, err := configPrompt(cfg, command)
+	if err != nil {
+		return "", err
+	}
+	if command == "commit" && cfg.Commit.Style != "" {
+		prompt += "\n\nFollow this commit message style, even where it differs from the instructions above: " + cfg.Commit.Style
+	}
+	return prompt, nil
+}
+
+func configPrompt(cfg *config.Config, command string) (string, error) {
+	template, ok := cfg.Prompts[command]
+	if !ok {
+		return prompts.Render(command, defaultPrompt(cfg, command))
+	}
+	prompt, err := prompts.Expand(template, prompts.NewData(command, defaultPrompt(cfg, command)))
+	if err != nil {
+		return "", fmt.Errorf("error in the %s prompt of the config: %w", command, err)
+	}
+	return prompt, nil
+}
+
+var promptsCmd = &cobra.Command{
+	Use:   "/prompts",
+	Short: "List, show and reset the system prompts of commands",
+	Long: `List, show and reset the system prompts of commands.
+To change the prompt of a command, write a template to the path shown by
+/prompts. Templates use Go's text/template syntax, and can refer to
+{{.Default}} (the built in prompt), {{.OS}}, {{.Shell}}, {{.Cwd}} and
+{{.Command}}.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, sources, err := config.LoadEffectiveConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+		for _, command := range promptCommands {
+			if _, ok := cfg.Prompts[command]; ok {
+				fmt.Printf("%-7s config   %s\n", command, sources.Source("prompts."+command))
+				continue
+			}
+			path, err := prompts.Path(command)
+			if err != nil {
+				return err
+			}
+			exists, err := prompts.Exists(command)
+			if err != nil {
+				return err
+			}
+			if exists {
+				fmt.Printf("%-7s custom   %s\n", command, path)
+			} else {
+				fmt.Printf("%-7s default  (override in %s)\n", command, path)
+			}
+		}
+		return nil
+	},
+}
+
+var promptsShowCmd = &cobra.Command{
+	Use:               "show [command]",
+	Short:             "Show the system prompt a command uses",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completePromptCommands,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := checkPromptCommand(args[0]); err != nil {
+			return err
+		}
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %w", err)
+		}
+
+		showDefault, _ := cmd.Flags().GetBool("default")
+		prompt := defaultPrompt(cfg, args[0])
+		if !showDefault {
+			prompt, err = systemPrompt(cfg, args[0])
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Println(prompt)
+		return nil
+	},
+}
+
+var promptsResetCmd = &cobra.Command{
+	Use:               "reset [command...]",
+	Short:             "Go back to the built in prompt, deleting your template",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completePromptCommands,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, command := range args {
+			if err := checkPromptCommand(command); err != nil {
+				return err
+			}
+			if err := prompts.Reset(command); err != nil {
+				return err
+			}
+			fmt.Printf("%s uses the built in prompt again\n", command)
+		}
+		return nil
+	},
+}
+
+func checkPromptCommand(command string) error {
+	for _, c := range promptCommands {
+		if c == command {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown command '%s'. Prompts can be set for: %s", command, strings.Join(promptCommands, ", "))
+}
+
+func completePromptCommands(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return promptCommands, cobra.ShellCompDirectiveNoFileComp
+}
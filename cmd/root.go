@@ -1,13 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/scottyeager/pal/abbr"
+	"github.com/scottyeager/pal/ai"
 	"github.com/scottyeager/pal/config"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var version string
@@ -29,6 +36,10 @@ func init() {
 	rootCmd.Flags().Bool("zsh-completion", false, "Print zsh autocompletion script and exit. Output is meant to be sourced by zsh")
 	rootCmd.PersistentFlags().Float64VarP(&temperature, "temperature", "t", 0, "Set the temperature for the AI model, between 0 and 2 (higher values make output more random)")
 	rootCmd.PersistentFlags().BoolVarP(&markdown, "markdown", "m", false, "Toggle markdown formatting in output (inverts your config setting)")
+	rootCmd.PersistentFlags().BoolVar(&ai.NoCache, "no-cache", false, "Don't use cached responses, even if the cache is enabled in your config")
+	rootCmd.PersistentFlags().BoolVar(&ai.ShowThinking, "show-thinking", false, "Print the reasoning of thinking models to stderr")
+	rootCmd.PersistentFlags().DurationVar(&ai.Timeout, "timeout", 0, "Give up waiting for a response after this long, such as 30s or 2m (overrides your config)")
+	rootCmd.PersistentFlags().StringVar(&config.Profile, "profile", "", "Use the config of this profile (overrides PAL_PROFILE and /profile use)")
 
 	// Disable help command. --help still works
 	rootCmd.SetHelpCommand(&cobra.Command{Hidden: true})
@@ -64,6 +75,7 @@ func preparse(args []string) int {
 				if _, ok := cmd.Annotations["takes_user_message"]; !ok {
 					return len(args)
 				}
+				return 2 + countLeadingFlags(cmd.Flags(), args[2:])
 			}
 		}
 		return 2
@@ -71,8 +83,15 @@ func preparse(args []string) int {
 
 	// If first arg is a flag, look for a command after it
 	if strings.HasPrefix(args[1], "-") {
-		for i, arg := range args {
+		// Skip the program name, which could be an absolute path
+		for i, arg := range args[1:] {
+			i++
 			if strings.HasPrefix(arg, "/") {
+				for _, cmd := range rootCmd.Commands() {
+					if cmd.Name() == arg {
+						return i + 1 + countLeadingFlags(cmd.Flags(), args[i+1:])
+					}
+				}
 				return i + 1
 			}
 		}
@@ -82,6 +101,73 @@ func preparse(args []string) int {
 	return 1
 }
 
+// profileFromArgs finds the value of --profile, before the commands are
+// parsed. It's needed to register the custom commands, so it can't rely on
+// preparse, which has to know them. Only the global flags that come before
+// the command or user message count, also in completion requests
+func profileFromArgs(args []string) string {
+	if len(args) < 2 {
+		return ""
+	}
+	args = args[1:]
+	if args[0] == cobra.ShellCompRequestCmd || args[0] == cobra.ShellCompNoDescRequestCmd {
+		args = args[1:]
+	}
+	globals := pflag.NewFlagSet("global", pflag.ContinueOnError)
+	globals.AddFlagSet(rootCmd.Flags())
+	globals.AddFlagSet(rootCmd.PersistentFlags())
+	flags := args[:countLeadingFlags(globals, args)]
+	for i, arg := range flags {
+		if value, ok := strings.CutPrefix(arg, "--profile="); ok {
+			return value
+		}
+		if arg == "--profile" && i+1 < len(flags) {
+			return flags[i+1]
+		}
+	}
+	return ""
+}
+
+// countLeadingFlags returns how many of args, counting from the start, are
+// flags in flags along with their values. This lets commands that take a
+// user message also have their own flags, like "/ask -c ...". Parsing stops
+// at the first arg that isn't one of the flags.
+func countLeadingFlags(flags *pflag.FlagSet, args []string) int {
+	i := 0
+	for i < len(args) {
+		arg := args[i]
+		if arg == "--" {
+			return i + 1
+		}
+
+		var flag *pflag.Flag
+		hasValue := false
+		if name, ok := strings.CutPrefix(arg, "--"); ok {
+			name, _, hasValue = strings.Cut(name, "=")
+			flag = flags.Lookup(name)
+		} else if name, ok := strings.CutPrefix(arg, "-"); ok && len(name) > 0 {
+			// Only single shorthand flags, possibly with an attached value
+			flag = flags.ShorthandLookup(name[:1])
+			if flag != nil && len(name) > 1 {
+				if flag.NoOptDefVal != "" {
+					return i
+				}
+				hasValue = true
+			}
+		}
+		if flag == nil {
+			return i
+		}
+
+		i++
+		if !hasValue && flag.NoOptDefVal == "" {
+			// The flag takes a value in the next arg
+			i++
+		}
+	}
+	return min(i, len(args))
+}
+
 func Execute() {
 	if version != "" {
 		rootCmd.Version = version
@@ -89,6 +175,12 @@ func Execute() {
 		rootCmd.Version = "dev"
 	}
 
+	// Before anything else, so custom commands get completions and are
+	// preparsed like built in ones. Which commands there are depends on the
+	// profile, so that's found first
+	config.Profile = profileFromArgs(os.Args)
+	registerCustomCommands()
+
 	// We define these as Cobra flags, so that help and autocomplete works, but
 	// we handle them straight out of the gate here and bypass Cobra. One reason
 	// is to simplify the preparsing. Another reason is that these commands
@@ -146,8 +238,26 @@ func Execute() {
 		}
 	}
 
-	if err := rootCmd.Execute(); err != nil {
+	// Interrupting cancels any in flight requests. Files are written
+	// atomically, so if the command doesn't wrap up quickly (say it's waiting
+	// for input), it's safe to just exit
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+		time.Sleep(time.Second)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			fmt.Fprintln(os.Stderr, "\nInterrupted")
+			os.Exit(130)
+		}
+	}()
+
+	if err := rootCmd.ExecuteContext(ctx); err != nil {
 		// fmt.Println(err)
+		if ctx.Err() != nil {
+			os.Exit(130)
+		}
 		os.Exit(1)
 	}
 }
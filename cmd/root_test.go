@@ -60,6 +60,36 @@ func TestPreparse(t *testing.T) {
 			args:     []string{"pal", "-t0.7", "/ask", "what", "is", "-t"},
 			expected: 3,
 		},
+		{
+			name:     "/ask with its own flag",
+			args:     []string{"pal", "/ask", "-c", "and", "then", "-c"},
+			expected: 3,
+		},
+		{
+			name:     "/ask with flag taking a value",
+			args:     []string{"pal", "/ask", "--session", "foo", "what", "next"},
+			expected: 4,
+		},
+		{
+			name:     "/ask with flag value attached",
+			args:     []string{"pal", "-t0.7", "/ask", "-sfoo", "--continue", "what"},
+			expected: 5,
+		},
+		{
+			name:     "/ask with global flag after the command is user message",
+			args:     []string{"pal", "/ask", "--show-thinking", "-t", "0.5", "why"},
+			expected: 2,
+		},
+		{
+			name:     "/ask with unknown flag is user message",
+			args:     []string{"pal", "/ask", "-x", "what"},
+			expected: 2,
+		},
+		{
+			name:     "program name is an absolute path",
+			args:     []string{"/usr/local/bin/pal", "-t", "0.5", "/cmd", "input"},
+			expected: 4,
+		},
 		{
 			name:     "/model command",
 			args:     []string{"pal", "/model", "sooperAI/pal"},
@@ -76,3 +106,29 @@ func TestPreparse(t *testing.T) {
 		})
 	}
 }
+
+func TestProfileFromArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"pal", "--profile", "work", "/ask", "hi"}, "work"},
+		{[]string{"pal", "--profile=work", "/cmd", "list", "files"}, "work"},
+		{[]string{"pal", "/ask", "--profile", "work", "hi"}, ""},
+		{[]string{"pal", "/ask", "what", "does", "--profile", "do"}, ""},
+		{[]string{"pal", "list", "files"}, ""},
+		{[]string{"pal", "list", "--profile", "work"}, ""},
+		{[]string{"pal", "--profile", "work", "--help"}, "work"},
+		{[]string{"pal", "-t", "0.5", "--profile", "work", "list", "files"}, "work"},
+		{[]string{"pal", "--profile", "work", "/custom", "hi"}, "work"},
+		{[]string{"pal", "__complete", "--profile", "work", "/"}, "work"},
+		{[]string{"pal", "__complete", "/ask", "--profile", "work"}, ""},
+		{[]string{"pal"}, ""},
+	}
+
+	for _, tt := range tests {
+		if actual := profileFromArgs(tt.args); actual != tt.expected {
+			t.Errorf("profileFromArgs(%v) = %q; want %q", tt.args, actual, tt.expected)
+		}
+	}
+}
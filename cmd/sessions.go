@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/scottyeager/pal/session"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(sessionsCmd)
+	sessionsCmd.AddCommand(sessionsResumeCmd)
+	sessionsCmd.AddCommand(sessionsRenameCmd)
+	sessionsCmd.AddCommand(sessionsDeleteCmd)
+}
+
+var sessionsCmd = &cobra.Command{
+	Use:   "/sessions",
+	Short: "List, resume, rename and delete /ask sessions",
+	Long: `List, resume, rename and delete /ask sessions.
+Every /ask is saved as a session. Use 'pal /ask -c' to continue the last one,
+or 'pal /ask -s name' to continue a session by name.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sessions, err := session.List()
+		if err != nil {
+			return fmt.Errorf("error listing sessions: %w", err)
+		}
+
+		if len(sessions) == 0 {
+			fmt.Println("No sessions yet. Sessions are saved each time you use /ask")
+			return nil
+		}
+
+		last, _ := session.Last()
+		for _, s := range sessions {
+			marker := " "
+			if s.Name == last {
+				marker = "*"
+			}
+			fmt.Printf("%s %s  %s  %d message(s)\n", marker, s.Updated.Format("2006-01-02 15:04"), s.Name, len(s.Messages))
+		}
+		fmt.Println("\n* = last session, continued by 'pal /ask -c'")
+		return nil
+	},
+}
+
+var sessionsResumeCmd = &cobra.Command{
+	Use:               "resume [name]",
+	Short:             "Show a session and make it the one continued by 'pal /ask -c'",
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: completeSessionNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		s, err := session.Load(args[0])
+		if err != nil {
+			return err
+		}
+
+		for _, message := range s.Messages {
+			if message.Role == "user" {
+				for _, attachment := range message.Attachments {
+					fmt.Printf("> [attached %s]\n", attachment.Name)
+				}
+				fmt.Println("> " + strings.ReplaceAll(strings.TrimSpace(message.Content), "\n", "\n> "))
+			} else {
+				fmt.Println(strings.TrimSpace(message.Content))
+			}
+			fmt.Println()
+		}
+
+		if err := session.SetLast(s.Name); err != nil {
+			return err
+		}
+		fmt.Printf("Resumed session %s. Continue it with 'pal /ask -c ...'\n", s.Name)
+		return nil
+	},
+}
+
+var sessionsRenameCmd = &cobra.Command{
+	Use:               "rename [name] [new-name]",
+	Short:             "Rename a session",
+	Args:              cobra.ExactArgs(2),
+	ValidArgsFunction: completeSessionNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if err := session.Rename(args[0], args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Renamed session %s to %s\n", args[0], args[1])
+		return nil
+	},
+}
+
+var sessionsDeleteCmd = &cobra.Command{
+	Use:               "delete [name...]",
+	Short:             "Delete one or more sessions",
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: completeSessionNames,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		for _, name := range args {
+			if err := session.Delete(name); err != nil {
+				return err
+			}
+			fmt.Printf("Deleted session %s\n", name)
+		}
+		return nil
+	},
+}
+
+func completeSessionNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	// Only delete takes more than one existing session
+	if cmd.Name() != "delete" && len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	sessions, err := session.List()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var names []string
+	for _, s := range sessions {
+		names = append(names, s.Name)
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
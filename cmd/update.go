@@ -4,11 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"runtime"
 	"strings"
 
+	"github.com/scottyeager/pal/ai"
 	"github.com/scottyeager/pal/config"
 	"github.com/scottyeager/pal/inout"
 	"github.com/spf13/cobra"
@@ -26,8 +26,17 @@ var updateCmd = &cobra.Command{
 	Use:   "/update",
 	Short: "Update Pal to the latest version",
 	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig()
+		if err != nil {
+			return fmt.Errorf("error loading config: %v", err)
+		}
+		client, err := ai.NewHTTPClient("/update", cfg.Network)
+		if err != nil {
+			return err
+		}
+
 		// Get latest release from GitHub
-		resp, err := http.Get("https://api.github.com/repos/scottyeager/Pal/releases/latest")
+		resp, err := client.Get("https://api.github.com/repos/scottyeager/Pal/releases/latest")
 		if err != nil {
 			return fmt.Errorf("error checking for updates: %w", err)
 		}
@@ -51,11 +60,6 @@ var updateCmd = &cobra.Command{
 			return nil
 		}
 
-		cfg, err := config.LoadConfig()
-		if err != nil {
-			return fmt.Errorf("error loading config: %v", err)
-		}
-
 		fmt.Printf("Current version: %s\n", version)
 		fmt.Printf("New version available: %s\n\n", latestVersion)
 		execPath, err := os.Executable()
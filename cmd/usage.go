@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/scottyeager/pal/inout"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(usageCmd)
+	usageCmd.Flags().String("since", "", "Only include usage on or after this date (YYYY-MM-DD)")
+	usageCmd.Flags().String("month", "", "Only include usage in this month (YYYY-MM)")
+	usageCmd.Flags().String("by", "", "Only show one breakdown: day, model or command")
+}
+
+var usageCmd = &cobra.Command{
+	Use:   "/usage",
+	Short: "Report token usage and estimated costs",
+	Long: `Report token usage and estimated costs.
+Every request is recorded in a local ledger. Costs are estimated from the
+per model prices set in the config file, under each provider's "prices" key.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		since, _ := cmd.Flags().GetString("since")
+		month, _ := cmd.Flags().GetString("month")
+		by, _ := cmd.Flags().GetString("by")
+
+		var start, end time.Time
+		if since != "" {
+			t, err := time.ParseInLocation("2006-01-02", since, time.Local)
+			if err != nil {
+				return fmt.Errorf("invalid --since date, expected YYYY-MM-DD: %w", err)
+			}
+			start = t
+		}
+		if month != "" {
+			t, err := time.ParseInLocation("2006-01", month, time.Local)
+			if err != nil {
+				return fmt.Errorf("invalid --month, expected YYYY-MM: %w", err)
+			}
+			if t.After(start) {
+				start = t
+			}
+			end = t.AddDate(0, 1, 0)
+		}
+
+		records, err := inout.ReadUsage()
+		if err != nil {
+			return fmt.Errorf("error reading usage: %w", err)
+		}
+
+		var filtered []inout.UsageRecord
+		for _, record := range records {
+			if record.Timestamp.Before(start) || (!end.IsZero() && !record.Timestamp.Before(end)) {
+				continue
+			}
+			filtered = append(filtered, record)
+		}
+
+		if len(filtered) == 0 {
+			fmt.Println("No usage recorded for this period")
+			return nil
+		}
+
+		breakdowns := []struct {
+			name string
+			key  func(inout.UsageRecord) string
+		}{
+			{"day", func(r inout.UsageRecord) string { return r.Timestamp.Local().Format("2006-01-02") }},
+			{"model", func(r inout.UsageRecord) string { return r.Model }},
+			{"command", func(r inout.UsageRecord) string { return r.Command }},
+		}
+
+		shown := false
+		for _, breakdown := range breakdowns {
+			if by != "" && by != breakdown.name {
+				continue
+			}
+			if shown {
+				fmt.Println()
+			}
+			printUsageTable(breakdown.name, filtered, breakdown.key)
+			shown = true
+		}
+		if !shown {
+			return fmt.Errorf("invalid --by value '%s'. Use day, model or command", by)
+		}
+		return nil
+	},
+}
+
+type usageTotals struct {
+	requests int
+	input    int64
+	output   int64
+	cached   int64
+	cost     float64
+}
+
+func (t *usageTotals) add(record inout.UsageRecord) {
+	t.requests++
+	t.input += record.InputTokens
+	t.output += record.OutputTokens
+	t.cached += record.CachedTokens
+	t.cost += record.Cost
+}
+
+func printUsageTable(name string, records []inout.UsageRecord, key func(inout.UsageRecord) string) {
+	groups := make(map[string]*usageTotals)
+	var total usageTotals
+	for _, record := range records {
+		k := key(record)
+		if k == "" {
+			k = "(other)"
+		}
+		if groups[k] == nil {
+			groups[k] = &usageTotals{}
+		}
+		groups[k].add(record)
+		total.add(record)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "%s\trequests\tinput\tcached\toutput\tcost\n", name)
+	for _, k := range keys {
+		g := groups[k]
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.4f\n", k, g.requests, g.input, g.cached, g.output, g.cost)
+	}
+	fmt.Fprintf(w, "total\t%d\t%d\t%d\t%d\t%.4f\n", total.requests, total.input, total.cached, total.output, total.cost)
+	w.Flush()
+}
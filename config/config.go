@@ -4,6 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,8 +19,136 @@ type Config struct {
 	SelectedModel      string              `yaml:"selected_model"`
 	SelectedModels     map[string]string   `yaml:"selected_models"`
 	FormatMarkdown     bool                `yaml:"format_markdown"`
+	// Models to try in order when the selected model fails, globally and per
+	// command key
+	FallbackModels        []string            `yaml:"fallback_models,omitempty"`
+	CommandFallbackModels map[string][]string `yaml:"command_fallback_models,omitempty"`
+	Retry                 Retry               `yaml:"retry,omitempty"`
+	Cache                 Cache               `yaml:"cache,omitempty"`
+	// Time limit for getting a response, globally and per command key. This
+	// includes any retries and fallbacks
+	Timeout  time.Duration            `yaml:"timeout,omitempty"`
+	Timeouts map[string]time.Duration `yaml:"timeouts,omitempty"`
+	Tools    Tools                    `yaml:"tools,omitempty"`
+	// Proxy and TLS settings for all providers and for /update. Providers
+	// can override them
+	Network Network `yaml:"network,omitempty"`
+	// User defined slash commands
+	Commands []CustomCommand `yaml:"commands,omitempty"`
+	// Prompt templates by command key, which take precedence over the
+	// template files. Mostly for project files
+	Prompts map[string]string `yaml:"prompts,omitempty"`
+	Commit  Commit            `yaml:"commit,omitempty"`
+	Edit    Edit              `yaml:"edit,omitempty"`
 }
 
+type Commit struct {
+	// How commit messages should be written, like "Conventional commits,
+	// with the ticket ID from the branch name in the scope"
+	Style string `yaml:"style,omitempty"`
+}
+
+type Edit struct {
+	// Patterns of files that /edit leaves out when it's given a directory,
+	// like "*.pb.go" or "vendor/". They're matched against the name and the
+	// path of each file, and a trailing slash matches directories
+	Ignore []string `yaml:"ignore,omitempty"`
+}
+
+// Ignored reports whether /edit should leave out the file or directory at
+// path
+func (e Edit) Ignored(path string, isDir bool) bool {
+	path = filepath.ToSlash(filepath.Clean(path))
+	for _, pattern := range e.Ignore {
+		pattern, dirOnly := strings.CutSuffix(pattern, "/")
+		if dirOnly && !isDir {
+			continue
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// CustomCommand is a slash command defined in the config, like /regex for
+// "explain this regex"
+type CustomCommand struct {
+	// Used as /name
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+	// The system prompt, as a text/template like prompt templates. The
+	// built in prompt of the output mode is available as {{.Default}}
+	Prompt string `yaml:"prompt"`
+	// The command key for model selection, timeouts and usage. Defaults to
+	// the name
+	Key         string   `yaml:"key,omitempty"`
+	Temperature *float64 `yaml:"temperature,omitempty"`
+	// Include piped input with the query
+	Stdin bool `yaml:"stdin,omitempty"`
+	// One of OutputModes. Defaults to plain
+	Output string `yaml:"output,omitempty"`
+}
+
+// OutputModes are how a custom command shows its answer: as is, rendered as
+// markdown, as command suggestions written to the expansions file like /cmd,
+// or as raw file contents like /file
+var OutputModes = []string{"plain", "markdown", "cmd", "file"}
+
+// CommandKey returns the key the command's model is selected by
+func (c CustomCommand) CommandKey() string {
+	if c.Key != "" {
+		return c.Key
+	}
+	return c.Name
+}
+
+// Tools configures the read only tools that /ask can use to inspect the
+// system. Every tool call is confirmed first, unless it's auto approved
+type Tools struct {
+	// Offer tools on every /ask, rather than only with --tools
+	Enabled bool `yaml:"enabled"`
+	// Commands the model may run, matched on their leading words. Replaces
+	// DefaultToolCommands when set
+	Commands []string `yaml:"commands,omitempty"`
+	// Tool calls that run without confirmation. Either a tool name, like
+	// read_file, or the start of a command, like "systemctl status".
+	// command_help is always confirmed
+	AutoApprove []string `yaml:"auto_approve,omitempty"`
+}
+
+var DefaultToolCommands = []string{"systemctl status", "journalctl", "ls", "cat"}
+
+// Cache configures the on disk cache of responses. Only deterministic
+// requests, made with temperature 0, are cached
+type Cache struct {
+	Enabled bool          `yaml:"enabled"`
+	TTL     time.Duration `yaml:"ttl,omitempty"`
+	// Total size of cached responses in bytes
+	MaxSize int64 `yaml:"max_size,omitempty"`
+}
+
+// Retry controls how failed requests are retried before moving on to the next
+// fallback model. Zero values mean the defaults are used
+type Retry struct {
+	// Total number of attempts per model, including the first one
+	MaxAttempts    int           `yaml:"max_attempts,omitempty"`
+	InitialBackoff time.Duration `yaml:"initial_backoff,omitempty"`
+	MaxBackoff     time.Duration `yaml:"max_backoff,omitempty"`
+}
+
+const (
+	DefaultMaxAttempts    = 3
+	DefaultInitialBackoff = time.Second
+	DefaultMaxBackoff     = 30 * time.Second
+
+	DefaultCacheTTL     = 7 * 24 * time.Hour
+	DefaultCacheMaxSize = 10 * 1024 * 1024
+)
+
 func GetBasePath() (string, error) {
 	if xdgDataHome := os.Getenv("XDG_DATA_HOME"); xdgDataHome != "" {
 		return filepath.Join(xdgDataHome, "pal_helper"), nil
@@ -25,15 +158,132 @@ func GetBasePath() (string, error) {
 	return "", fmt.Errorf("unable to determine config directory")
 }
 
-func GetConfigPath() (string, error) {
+// Profile is the profile given with --profile. When it's empty, PAL_PROFILE
+// and then the profile chosen with /profile use decide
+var Profile string
+
+// DefaultProfile is the config directly in the base path, used when no
+// other profile is chosen
+const DefaultProfile = "default"
+
+var validProfileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ActiveProfile returns the name of the profile in use, and what chose it:
+// "--profile", "PAL_PROFILE", "/profile use" or "" for the default
+func ActiveProfile() (string, string) {
+	if Profile != "" {
+		return Profile, "--profile"
+	}
+	if profile := os.Getenv("PAL_PROFILE"); profile != "" {
+		return profile, "PAL_PROFILE"
+	}
+	if path, err := profileChoicePath(); err == nil {
+		if data, err := os.ReadFile(path); err == nil {
+			if profile := strings.TrimSpace(string(data)); profile != "" {
+				return profile, "/profile use"
+			}
+		}
+	}
+	return DefaultProfile, ""
+}
+
+// CheckProfileName returns an error if name can't be a profile name
+func CheckProfileName(name string) error {
+	if !validProfileName.MatchString(name) {
+		return fmt.Errorf("Profile names can only have letters, numbers, dots, dashes and underscores")
+	}
+	return nil
+}
+
+// ProfileDir returns the directory of a profile's config and prompts
+func ProfileDir(profile string) (string, error) {
 	basePath, err := GetBasePath()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(basePath, "config.yaml"), nil
+	if profile == DefaultProfile {
+		return basePath, nil
+	}
+	if err := CheckProfileName(profile); err != nil {
+		return "", err
+	}
+	return filepath.Join(basePath, "profiles", profile), nil
+}
+
+// Profiles returns the names of the profiles that have a config, always
+// including the default profile
+func Profiles() ([]string, error) {
+	basePath, err := GetBasePath()
+	if err != nil {
+		return nil, err
+	}
+	profiles := []string{DefaultProfile}
+	entries, err := os.ReadDir(filepath.Join(basePath, "profiles"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read profiles: %w", err)
+	}
+	for _, entry := range entries {
+		if _, err := os.Stat(filepath.Join(basePath, "profiles", entry.Name(), "config.yaml")); entry.IsDir() && err == nil {
+			profiles = append(profiles, entry.Name())
+		}
+	}
+	return profiles, nil
+}
+
+// UseProfile makes profile the one in use from now on, unless --profile or
+// PAL_PROFILE say otherwise
+func UseProfile(profile string) error {
+	path, err := profileChoicePath()
+	if err != nil {
+		return err
+	}
+	if profile == DefaultProfile {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to reset profile: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(path, []byte(profile+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to save profile: %w", err)
+	}
+	return nil
 }
 
+func profileChoicePath() (string, error) {
+	basePath, err := GetBasePath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(basePath, "profile"), nil
+}
+
+// GetConfigDir returns the directory of the active profile, where its config
+// and prompts are. Other data, like the expansions file, stays in the base
+// path
+func GetConfigDir() (string, error) {
+	profile, _ := ActiveProfile()
+	return ProfileDir(profile)
+}
+
+func GetConfigPath() (string, error) {
+	configDir, err := GetConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, "config.yaml"), nil
+}
+
+// LoadConfig returns the config in effect: the user's config, with the
+// project files of the current directory layered over it
 func LoadConfig() (*Config, error) {
+	cfg, _, err := LoadEffectiveConfig()
+	return cfg, err
+}
+
+// LoadUserConfig returns the user's config alone. Commands that change the
+// config and save it start from this, so project settings aren't saved into
+// it
+func LoadUserConfig() (*Config, error) {
 	cfgPath, err := GetConfigPath()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get config path: %w", err)
@@ -51,10 +301,33 @@ func LoadConfig() (*Config, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
+	warnPlaintextKeys.Do(func() { checkKeyPermissions(&cfg, cfgPath) })
 
 	return &cfg, nil
 }
 
+var warnPlaintextKeys sync.Once
+
+// checkKeyPermissions warns when API keys sit in a config file that other
+// users can read
+func checkKeyPermissions(cfg *Config, cfgPath string) {
+	if !WorldReadable(cfgPath) {
+		return
+	}
+	for _, provider := range cfg.Providers {
+		if provider.APIKey != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s has API keys in it and other users can read it. Run 'chmod 600 %s', or use api_key_env, api_key_file or api_key_cmd instead\n", cfgPath, cfgPath)
+			return
+		}
+	}
+}
+
+// WorldReadable reports whether users other than the owner can read path
+func WorldReadable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().Perm()&0004 != 0
+}
+
 func LoadConfigOrExit() *Config {
 	cfg, err := LoadConfig()
 	if err != nil {
@@ -84,6 +357,11 @@ func SaveConfig(cfg *Config) error {
 	if err := os.WriteFile(cfgPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
+	// WriteFile keeps the permissions of an existing file, which may be
+	// readable by others
+	if err := os.Chmod(cfgPath, 0600); err != nil {
+		return fmt.Errorf("failed to set config file permissions: %w", err)
+	}
 
 	return nil
 }
@@ -95,6 +373,21 @@ func CheckConfiguration(cfg *Config) error {
 	if cfg.SelectedModel == "" && len(cfg.SelectedModels) == 0 {
 		return fmt.Errorf("No model selected. Run 'pal /models' to select a model")
 	}
+	return CheckSettings(cfg)
+}
+
+// CheckSettings checks that the settings in cfg are valid, without requiring
+// it to be complete. A config being provisioned step by step can have no
+// providers or selected model yet
+func CheckSettings(cfg *Config) error {
+	for name, provider := range cfg.Providers {
+		if provider.AuthStyle != "" && !slices.Contains(AuthStyles, provider.AuthStyle) {
+			return fmt.Errorf("Provider %s has unknown auth_style '%s'. Use one of: %s", name, provider.AuthStyle, strings.Join(AuthStyles, ", "))
+		}
+		if provider.keySources() > 1 {
+			return fmt.Errorf("Provider %s has more than one of api_key, api_key_env, api_key_file and api_key_cmd. Keep only one", name)
+		}
+	}
 
 	// Check default model
 	if cfg.SelectedModel != "" {
@@ -117,26 +410,40 @@ func CheckConfiguration(cfg *Config) error {
 
 	// Check every model in SelectedModels map
 	for key, selectedModel := range cfg.SelectedModels {
-		modelFound := false
-		for provider_name, provider := range cfg.Providers {
-			for _, model := range provider.Models {
-				if provider_name+"/"+model == selectedModel {
-					modelFound = true
-					break
-				}
-			}
-			if modelFound {
-				break
-			}
-		}
-		if !modelFound {
+		if !ModelConfigured(cfg, selectedModel) {
 			return fmt.Errorf("Selected model '%s' for key '%s' not found in current configuration. Run 'pal /models' to select a valid model", selectedModel, key)
 		}
 	}
 
+	for _, model := range cfg.FallbackModels {
+		if !ModelConfigured(cfg, model) {
+			return fmt.Errorf("Fallback model '%s' not found in current configuration", model)
+		}
+	}
+	for key, models := range cfg.CommandFallbackModels {
+		for _, model := range models {
+			if !ModelConfigured(cfg, model) {
+				return fmt.Errorf("Fallback model '%s' for key '%s' not found in current configuration", model, key)
+			}
+		}
+	}
+
 	return nil
 }
 
+// ModelConfigured reports whether fullName, like "deepseek/deepseek-chat", is
+// one of the configured models
+func ModelConfigured(cfg *Config, fullName string) bool {
+	for provider_name, provider := range cfg.Providers {
+		for _, model := range provider.Models {
+			if provider_name+"/"+model == fullName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func GetSelectedModel(cfg *Config, key string) string {
 	if len(cfg.SelectedModels) > 0 {
 		if val, ok := cfg.SelectedModels[key]; ok {
@@ -145,3 +452,21 @@ func GetSelectedModel(cfg *Config, key string) string {
 	}
 	return cfg.SelectedModel
 }
+
+// GetFallbackModels returns the models to try, in order, when the selected
+// model for key fails
+func GetFallbackModels(cfg *Config, key string) []string {
+	if models, ok := cfg.CommandFallbackModels[key]; ok {
+		return models
+	}
+	return cfg.FallbackModels
+}
+
+// GetTimeout returns the time limit for requests made by the command key, or
+// zero if there is none
+func GetTimeout(cfg *Config, key string) time.Duration {
+	if timeout, ok := cfg.Timeouts[key]; ok {
+		return timeout
+	}
+	return cfg.Timeout
+}
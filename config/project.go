@@ -0,0 +1,224 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileName is the name of project config files. Those found in the
+// current directory and the ones above it are layered over the user's config
+const ProjectFileName = ".pal.yaml"
+
+// projectKeys are the settings a project file can have. Providers aren't
+// among them, so API keys are never read from a project: a project could
+// also point a provider's URL at its own server, or run a command with
+// api_key_cmd
+var projectKeys = []string{
+	"selected_model",
+	"selected_models",
+	"fallback_models",
+	"command_fallback_models",
+	"format_markdown",
+	"timeout",
+	"timeouts",
+	"prompts",
+	"commit",
+	"edit",
+}
+
+// Sources says which file each setting came from, by its path of keys
+// separated by dots, like "selected_models.edit"
+type Sources map[string]string
+
+// Source returns the file the setting at path came from, also for settings
+// inside it
+func (s Sources) Source(path string) string {
+	for ; path != ""; path = path[:max(strings.LastIndex(path, "."), 0)] {
+		if source, ok := s[path]; ok {
+			return source
+		}
+	}
+	return ""
+}
+
+// ProjectFiles returns the project config files that apply in the current
+// directory, outermost first
+func ProjectFiles() ([]string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	slices.Reverse(files)
+	return files, nil
+}
+
+// LoadEffectiveConfig loads the user's config with the project files layered
+// over it, and says where each setting came from. Maps are merged, while
+// other values and lists are replaced. Merging works on the YAML nodes, so
+// values keep the types they'd have in the user's config
+func LoadEffectiveConfig() (*Config, Sources, error) {
+	cfgPath, err := GetConfigPath()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get config path: %w", err)
+	}
+
+	data, err := os.ReadFile(cfgPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	merged, err := parseMapping(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	sources := Sources{}
+	recordSources(merged, "", cfgPath, sources)
+
+	projects, err := ProjectFiles()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, path := range projects {
+		project, err := loadProjectFile(path)
+		if err != nil {
+			return nil, nil, err
+		}
+		mergeSettings(merged, project, "", path, sources)
+	}
+
+	var cfg Config
+	if err := merged.Decode(&cfg); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	warnPlaintextKeys.Do(func() { checkKeyPermissions(&cfg, cfgPath) })
+	return &cfg, sources, nil
+}
+
+// parseMapping parses a YAML document that has a mapping at the top, which
+// is empty if the document is
+func parseMapping(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("line %d: expected a mapping of settings", root.Line)
+	}
+	return root, nil
+}
+
+var (
+	warnedMu sync.Mutex
+	warned   = map[string]bool{}
+)
+
+// loadProjectFile reads a project file, leaving out the settings projects
+// can't have
+func loadProjectFile(path string) (*yaml.Node, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	project, err := parseMapping(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var ignored []string
+	var kept []*yaml.Node
+	for i := 0; i+1 < len(project.Content); i += 2 {
+		key := project.Content[i].Value
+		if !slices.Contains(projectKeys, key) {
+			ignored = append(ignored, key)
+			continue
+		}
+		kept = append(kept, project.Content[i], project.Content[i+1])
+	}
+	project.Content = kept
+	if len(ignored) > 0 {
+		sort.Strings(ignored)
+		warnedMu.Lock()
+		if !warned[path] {
+			fmt.Fprintf(os.Stderr, "Warning: ignoring %s in %s. Projects can only set %s, and never providers or API keys\n", strings.Join(ignored, ", "), path, strings.Join(projectKeys, ", "))
+			warned[path] = true
+		}
+		warnedMu.Unlock()
+	}
+	return project, nil
+}
+
+// mergeSettings merges the mapping src into dst, recording source for every
+// setting it changes
+func mergeSettings(dst *yaml.Node, src *yaml.Node, prefix string, source string, sources Sources) {
+	for i := 0; i+1 < len(src.Content); i += 2 {
+		key, value := src.Content[i], src.Content[i+1]
+		path := key.Value
+		if prefix != "" {
+			path = prefix + "." + key.Value
+		}
+		existing := mappingValue(dst, key.Value)
+		if existing != nil && existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+			mergeSettings(existing, value, path, source, sources)
+			continue
+		}
+
+		if existing != nil {
+			*existing = *value
+		} else {
+			dst.Content = append(dst.Content, key, value)
+		}
+		for p := range sources {
+			if strings.HasPrefix(p, path+".") {
+				delete(sources, p)
+			}
+		}
+		recordSources(value, path, source, sources)
+	}
+}
+
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func recordSources(node *yaml.Node, path string, source string, sources Sources) {
+	if node.Kind == yaml.MappingNode && len(node.Content) > 0 {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if path != "" {
+				key = path + "." + key
+			}
+			recordSources(node.Content[i+1], key, source, sources)
+		}
+		return
+	}
+	if path != "" {
+		sources[path] = source
+	}
+}
@@ -1,9 +1,216 @@
 package config
 
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
 type Provider struct {
-	URL    string   `yaml:"url"`
-	APIKey string   `yaml:"api_key"`
-	Models []string `yaml:"models"`
+	// Type selects the API used to talk to the provider, such as "openai" for
+	// OpenAI compatible APIs or "anthropic". When empty, it's inferred from
+	// the provider name
+	Type string `yaml:"type,omitempty"`
+	// The API's base URL. {model} is replaced with the model name, for APIs
+	// like Azure OpenAI that have the model in the path
+	URL    string `yaml:"url"`
+	APIKey string `yaml:"api_key"`
+	// Alternatives to keeping the key in the config: the name of an
+	// environment variable, a file holding the key, or a shell command that
+	// prints it, like "pass show deepseek". Only one of them can be set
+	APIKeyEnv  string   `yaml:"api_key_env,omitempty"`
+	APIKeyFile string   `yaml:"api_key_file,omitempty"`
+	APIKeyCmd  string   `yaml:"api_key_cmd,omitempty"`
+	Models     []string `yaml:"models"`
+	// Models that /models --refresh added. Together with the template's
+	// models, they tell what's safe to remove on the next refresh from
+	// what was added by hand
+	RefreshedModels []string `yaml:"refreshed_models,omitempty"`
+	// How the API key is sent, one of AuthStyles. When empty, it's the usual
+	// for the provider type: x-api-key for Anthropic and bearer otherwise
+	AuthStyle string `yaml:"auth_style,omitempty"`
+	// Sent with every request, for gateways that need their own auth
+	// headers, or OpenRouter's attribution headers
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Added to every request URL, like Azure's api-version
+	QueryParams map[string]string `yaml:"query_params,omitempty"`
+	// Proxy and TLS settings, over the ones for all providers
+	Network `yaml:",inline"`
+	// Models that accept images and PDFs, which /ask can attach
+	Vision []string `yaml:"vision,omitempty"`
+	// Prices by model name, used to estimate costs in the usage ledger
+	Prices map[string]Price `yaml:"prices,omitempty"`
+	// Time limit for each request to this provider. Requests that time out
+	// are retried
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Ollama only: model options like num_ctx, and how long the model stays
+	// loaded after a request
+	Options   map[string]any `yaml:"options,omitempty"`
+	KeepAlive string         `yaml:"keep_alive,omitempty"`
+	// Generation parameters for all of the provider's models, and overrides
+	// for single models
+	Params      Params            `yaml:"params,omitempty"`
+	ModelParams map[string]Params `yaml:"model_params,omitempty"`
+	// Mock only: the file of canned responses, and where to record the
+	// requests. Relative paths are relative to the config directory
+	Fixtures string `yaml:"fixtures,omitempty"`
+	Record   string `yaml:"record,omitempty"`
+}
+
+// Network holds the settings for reaching a server through a corporate proxy
+// or TLS interception. Relative paths are relative to the config directory
+type Network struct {
+	// Like http://proxy.example.com:3128. When empty, HTTPS_PROXY and
+	// friends from the environment are used
+	Proxy string `yaml:"proxy,omitempty"`
+	// PEM file of CA certificates to trust, on top of the system's
+	CAFile string `yaml:"ca_file,omitempty"`
+	// Turns off certificate verification altogether. Only for
+	// troubleshooting, since anyone on the way can read the traffic
+	InsecureSkipVerify bool `yaml:"insecure_skip_verify,omitempty"`
+	// PEM files of a client certificate and its key, for servers that
+	// require one. The key can be left out when it's in the certificate file
+	ClientCert string `yaml:"client_cert,omitempty"`
+	ClientKey  string `yaml:"client_key,omitempty"`
+}
+
+// Or returns n, with anything it leaves unset taken from defaults
+func (n Network) Or(defaults Network) Network {
+	if n.Proxy == "" {
+		n.Proxy = defaults.Proxy
+	}
+	if n.CAFile == "" {
+		n.CAFile = defaults.CAFile
+	}
+	n.InsecureSkipVerify = n.InsecureSkipVerify || defaults.InsecureSkipVerify
+	if n.ClientCert == "" {
+		n.ClientCert = defaults.ClientCert
+		n.ClientKey = defaults.ClientKey
+	}
+	return n
+}
+
+// Auth styles say which header carries the API key. AuthBearer sends
+// "Authorization: Bearer <key>", AuthAPIKey and AuthXAPIKey send the key as is
+// in an api-key or x-api-key header, and AuthNone sends no key at all
+const (
+	AuthBearer  = "bearer"
+	AuthAPIKey  = "api-key"
+	AuthXAPIKey = "x-api-key"
+	AuthNone    = "none"
+)
+
+var AuthStyles = []string{AuthBearer, AuthAPIKey, AuthXAPIKey, AuthNone}
+
+// Params are generation parameters. Anything left unset is up to the
+// provider's defaults
+type Params struct {
+	MaxTokens int64    `yaml:"max_tokens,omitempty"`
+	TopP      *float64 `yaml:"top_p,omitempty"`
+	Stop      []string `yaml:"stop,omitempty"`
+	// For reasoning models: low, medium or high
+	ReasoningEffort string `yaml:"reasoning_effort,omitempty"`
+	// Anthropic only: tokens the model may spend on extended thinking
+	ThinkingBudget int64 `yaml:"thinking_budget,omitempty"`
+	// Parameters the model rejects, which are never sent. Any of
+	// temperature, top_p, max_tokens and stop
+	Omit []string `yaml:"omit,omitempty"`
+	// Raw fields added to the request body, for options pal doesn't know
+	// about
+	ExtraBody map[string]any `yaml:"extra_body,omitempty"`
+}
+
+// ParamsFor returns the generation parameters for model, with its overrides
+// applied over the provider wide ones
+func (p Provider) ParamsFor(model string) Params {
+	params := p.Params
+	override, ok := p.ModelParams[model]
+	if !ok {
+		return params
+	}
+
+	if override.MaxTokens != 0 {
+		params.MaxTokens = override.MaxTokens
+	}
+	if override.TopP != nil {
+		params.TopP = override.TopP
+	}
+	if override.Stop != nil {
+		params.Stop = override.Stop
+	}
+	if override.ReasoningEffort != "" {
+		params.ReasoningEffort = override.ReasoningEffort
+	}
+	if override.ThinkingBudget != 0 {
+		params.ThinkingBudget = override.ThinkingBudget
+	}
+	params.Omit = append(slices.Clone(params.Omit), override.Omit...)
+	if override.ExtraBody != nil {
+		extra := maps.Clone(params.ExtraBody)
+		if extra == nil {
+			extra = map[string]any{}
+		}
+		maps.Copy(extra, override.ExtraBody)
+		params.ExtraBody = extra
+	}
+	return params
+}
+
+// KeySource describes where the provider's API key comes from, or returns ""
+// if it has none
+func (p Provider) KeySource() string {
+	switch {
+	case p.APIKeyEnv != "":
+		return "environment variable " + p.APIKeyEnv
+	case p.APIKeyFile != "":
+		return "file " + p.APIKeyFile
+	case p.APIKeyCmd != "":
+		return "command '" + p.APIKeyCmd + "'"
+	case p.APIKey != "":
+		return "config file"
+	}
+	return ""
+}
+
+// keySources counts how many ways of getting the API key are set
+func (p Provider) keySources() int {
+	n := 0
+	for _, source := range []string{p.APIKey, p.APIKeyEnv, p.APIKeyFile, p.APIKeyCmd} {
+		if source != "" {
+			n++
+		}
+	}
+	return n
+}
+
+// SupportsVision reports whether model is marked as taking images and PDFs
+func (p Provider) SupportsVision(model string) bool {
+	return slices.Contains(p.Vision, model)
+}
+
+// Omits reports whether the parameter should be left out of requests
+func (p Params) Omits(param string) bool {
+	return slices.Contains(p.Omit, param)
+}
+
+// Price is what a model costs per million tokens. When CachedInput is zero,
+// cached input tokens are priced as regular input
+type Price struct {
+	Input       float64 `yaml:"input"`
+	Output      float64 `yaml:"output"`
+	CachedInput float64 `yaml:"cached_input,omitempty"`
+}
+
+// Cost estimates the cost of a request. inputTokens includes cachedTokens
+func (p Price) Cost(inputTokens int64, outputTokens int64, cachedTokens int64) float64 {
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	cost := float64(inputTokens-cachedTokens)*p.Input +
+		float64(cachedTokens)*cachedPrice +
+		float64(outputTokens)*p.Output
+	return cost / 1_000_000
 }
 
 func NewProvider(providerName string, apiKey string) Provider {
@@ -34,7 +241,8 @@ var ProviderTemplates = map[string]Provider{
 		// Anthropic SDK requires no trailing slash, while OpenAI needs it
 		// We might want to let it connect automatically since it's using it's
 		// native SDK
-		URL: "https://api.anthropic.com/v1",
+		Type: "anthropic",
+		URL:  "https://api.anthropic.com/v1",
 		Models: []string{
 			"claude-opus-4-0",
 			"claude-sonnet-4-0",
@@ -42,6 +250,13 @@ var ProviderTemplates = map[string]Provider{
 			"claude-3-5-sonnet-latest",
 			"claude-3-5-haiku-latest",
 		},
+		Vision: []string{
+			"claude-opus-4-0",
+			"claude-sonnet-4-0",
+			"claude-3-7-sonnet-latest",
+			"claude-3-5-sonnet-latest",
+			"claude-3-5-haiku-latest",
+		},
 	},
 	"openai": {
 		URL: "https://api.openai.com/v1/",
@@ -57,6 +272,18 @@ var ProviderTemplates = map[string]Provider{
 			"o3-pro",
 			"o3-mini",
 		},
+		// o3-mini doesn't take images
+		Vision: []string{
+			"gpt-4.1",
+			"gpt-4.1-mini",
+			"gpt-4.1-nano",
+			"gpt-4o",
+			"gpt-4o-mini",
+			"chatgpt-4o-latest",
+			"o4-mini",
+			"o3",
+			"o3-pro",
+		},
 	},
 	"mistral": {
 		URL: "https://api.mistral.ai/v1/",
@@ -74,6 +301,20 @@ var ProviderTemplates = map[string]Provider{
 			"mistral-small-latest",
 		},
 	},
+	"azure": {
+		// Azure OpenAI addresses models by the name of their deployment. /config
+		// asks for the resource name and the deployments
+		URL:       "https://YOUR-RESOURCE.openai.azure.com/openai/deployments/{model}/",
+		AuthStyle: AuthAPIKey,
+		QueryParams: map[string]string{
+			"api-version": "2024-10-21",
+		},
+	},
+	"ollama": {
+		// Models are discovered from the Ollama daemon when it's configured
+		Type: "ollama",
+		URL:  "http://localhost:11434",
+	},
 	"google": {
 		URL: "https://generativelanguage.googleapis.com/v1beta/openai/",
 		Models: []string{
@@ -86,5 +327,15 @@ var ProviderTemplates = map[string]Provider{
 			"gemini-1.5-flash-8b",
 			"gemini-1.5-pro",
 		},
+		Vision: []string{
+			"gemini-2.5-pro",
+			"gemini-2.5-flash",
+			"gemini-2.5-flash-lite-preview-06-17",
+			"gemini-2.0-flash",
+			"gemini-2.0-flash-lite",
+			"gemini-1.5-flash",
+			"gemini-1.5-flash-8b",
+			"gemini-1.5-pro",
+		},
 	},
 }
@@ -73,19 +73,28 @@ func StorePrefix0Command(command string) error {
 
 	// Write new content with prefix0 command and preserved expansions
 	newContent := command + "\n" + expansions
-	if err := os.WriteFile(storagePath, []byte(newContent), 0644); err != nil {
+	if err := WriteFileAtomic(storagePath, []byte(newContent), 0644); err != nil {
 		return fmt.Errorf("failed to write prefix0 command to disk: %w", err)
 	}
 
 	return nil
 }
 
-func StoreCommands(completion string) error {
+// ExpansionsPath returns the path of the expansions file. It's where the
+// fish and zsh abbreviation scripts look for it too
+func ExpansionsPath() (string, error) {
 	basePath, err := config.GetBasePath()
 	if err != nil {
-		return fmt.Errorf("failed to get base path: %w", err)
+		return "", fmt.Errorf("failed to get base path: %w", err)
+	}
+	return filepath.Join(basePath, commandFileName), nil
+}
+
+func StoreCommands(completion string) error {
+	storagePath, err := ExpansionsPath()
+	if err != nil {
+		return err
 	}
-	storagePath := filepath.Join(basePath, commandFileName)
 
 	// Ensure directory exists
 	storageDir := filepath.Dir(storagePath)
@@ -112,7 +121,7 @@ func StoreCommands(completion string) error {
 
 	// Write new content with preserved prefix0
 	newContent := prefix0 + completion
-	if err := os.WriteFile(storagePath, []byte(newContent), 0644); err != nil {
+	if err := WriteFileAtomic(storagePath, []byte(newContent), 0644); err != nil {
 		return fmt.Errorf("failed to write commands to disk: %w", err)
 	}
 
@@ -133,3 +142,35 @@ func StoreCommands(completion string) error {
 
 	return nil
 }
+
+// WriteFileAtomic writes data to a temporary file and then renames it over
+// path. If pal is interrupted, path is either left untouched or fully
+// written, never truncated. An existing file keeps its permissions.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
@@ -0,0 +1,93 @@
+package inout
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/scottyeager/pal/config"
+)
+
+const usageFileName = "usage.jsonl"
+
+// UsageRecord is one line of the usage ledger, written for every completion
+type UsageRecord struct {
+	Timestamp    time.Time `json:"timestamp"`
+	Command      string    `json:"command"`
+	Model        string    `json:"model"`
+	InputTokens  int64     `json:"input_tokens"`
+	OutputTokens int64     `json:"output_tokens"`
+	CachedTokens int64     `json:"cached_tokens"`
+	Cost         float64   `json:"cost"`
+}
+
+func getUsagePath() (string, error) {
+	basePath, err := config.GetBasePath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get base path: %w", err)
+	}
+	return filepath.Join(basePath, usageFileName), nil
+}
+
+func AppendUsage(record UsageRecord) error {
+	usagePath, err := getUsagePath()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(usagePath), 0755); err != nil {
+		return fmt.Errorf("failed to create storage directory: %w", err)
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage record: %w", err)
+	}
+
+	file, err := os.OpenFile(usagePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer file.Close()
+
+	// A single write keeps lines intact even with concurrent pal processes
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage record: %w", err)
+	}
+	return nil
+}
+
+// ReadUsage returns all records in the ledger. Lines that can't be parsed are
+// skipped
+func ReadUsage() ([]UsageRecord, error) {
+	usagePath, err := getUsagePath()
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(usagePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer file.Close()
+
+	var records []UsageRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record UsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		records = append(records, record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read usage ledger: %w", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,652 @@
+package main_test
+
+// Integration tests run the pal binary against the mock provider, in a
+// temporary git repo with its own XDG_DATA_HOME. They catch regressions in
+// what the commands send and in the files they write.
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var palBinary string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "pal-integration")
+	if err != nil {
+		panic(err)
+	}
+	palBinary = filepath.Join(dir, "pal")
+	build := exec.Command("go", "build", "-o", palBinary, ".")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		os.RemoveAll(dir)
+		panic("failed to build pal: " + err.Error())
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// env is a sandbox for running pal: a config using the mock provider, and a
+// git repo to run commands in
+type env struct {
+	t       *testing.T
+	dataDir string
+	repo    string
+	vars    []string
+}
+
+const testConfig = `providers:
+  mock:
+    type: mock
+    url: ""
+    api_key: ""
+    models: [test, broken]
+    fixtures: fixtures.yaml
+selected_model: mock/test
+`
+
+func newEnv(t *testing.T, fixtures string) *env {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	root := t.TempDir()
+	e := &env{
+		t:       t,
+		dataDir: filepath.Join(root, "data", "pal_helper"),
+		repo:    filepath.Join(root, "repo"),
+	}
+	// pal cleans up an old data directory under HOME, so give it a fake one
+	e.vars = append(os.Environ(),
+		"HOME="+root,
+		"XDG_DATA_HOME="+filepath.Join(root, "data"),
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=Test", "GIT_COMMITTER_EMAIL=test@example.com",
+		"EDITOR=true",
+	)
+
+	e.write(filepath.Join(e.dataDir, "config.yaml"), testConfig)
+	e.write(filepath.Join(e.dataDir, "fixtures.yaml"), fixtures)
+
+	e.write(filepath.Join(e.repo, "greet.go"), "package main\n\nfunc greet() string {\n\treturn \"hello\"\n}\n")
+	e.git("init", "-q")
+	e.git("add", "-A")
+	e.git("commit", "-q", "-m", "Initial commit")
+	return e
+}
+
+func (e *env) write(path string, contents string) {
+	e.t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		e.t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		e.t.Fatal(err)
+	}
+}
+
+func (e *env) read(path string) string {
+	e.t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return string(data)
+}
+
+func (e *env) git(args ...string) string {
+	e.t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = e.repo
+	cmd.Env = e.vars
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		e.t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return string(out)
+}
+
+// run runs pal in the repo and returns its stdout. Without stdin, stdin is
+// left unconnected so pal doesn't wait for piped input
+func (e *env) run(stdin string, args ...string) string {
+	e.t.Helper()
+	cmd := exec.Command(palBinary, args...)
+	cmd.Dir = e.repo
+	cmd.Env = e.vars
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		e.t.Fatalf("pal %s: %v\nstdout:\n%s\nstderr:\n%s", strings.Join(args, " "), err, out, stderr.String())
+	}
+	return string(out)
+}
+
+type request struct {
+	Command     string  `json:"command"`
+	Model       string  `json:"model"`
+	Stream      bool    `json:"stream"`
+	System      string  `json:"system"`
+	Schema      string  `json:"schema"`
+	Temperature float64 `json:"temperature"`
+	Messages    []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+}
+
+// requests returns the requests the mock provider received
+func (e *env) requests() []request {
+	e.t.Helper()
+	f, err := os.Open(filepath.Join(e.dataDir, "mock_requests.jsonl"))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	defer f.Close()
+
+	var requests []request
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		var r request
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			e.t.Fatal(err)
+		}
+		requests = append(requests, r)
+	}
+	return requests
+}
+
+func TestCmd(t *testing.T) {
+	e := newEnv(t, `
+- command: cmd
+  prompt: list files
+  response: '{"commands": [{"command": "ls -la", "explanation": "Long listing"}, {"command": "ls -1", "explanation": "One per line"}], "message": ""}'
+- command: cmd
+  prompt: disk
+  response: |
+    Here you go:
+    `+"```"+`
+    df -h
+    du -sh *
+    `+"```"+`
+- command: cmd
+  prompt: wipe
+  response: '{"commands": [], "message": "That would wipe your system"}'
+`)
+
+	out := e.run("", "/cmd", "list", "files")
+	if !strings.Contains(out, "1. ls -la\n   Long listing\n2. ls -1") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	// The first line is reserved for the prefix0 command
+	expansions := filepath.Join(e.dataDir, "expansions.txt")
+	if got := e.read(expansions); got != "\nls -la\nls -1" {
+		t.Errorf("expansions file = %q", got)
+	}
+
+	// Without a slash command, /cmd is the default. The response isn't JSON
+	// here, so the suggestions are taken from the code block
+	e.run("", "check", "disk", "usage")
+	if got := e.read(expansions); got != "\ndf -h\ndu -sh *" {
+		t.Errorf("expansions file = %q", got)
+	}
+
+	requests := e.requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if r := requests[0]; r.Command != "cmd" || r.Schema == "" || r.Messages[0].Content != "list files" {
+		t.Errorf("unexpected request %+v", r)
+	}
+
+	// A refusal leaves the previous suggestions alone
+	if out := e.run("", "/cmd", "wipe", "everything"); !strings.Contains(out, "That would wipe your system") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if got := e.read(expansions); got != "\ndf -h\ndu -sh *" {
+		t.Errorf("expansions file = %q", got)
+	}
+}
+
+func TestAsk(t *testing.T) {
+	e := newEnv(t, `
+- command: ask
+  prompt: Mars
+  response: Thin air scatters less light.
+- command: ask
+  prompt: sky
+  response: Rayleigh scattering.
+`)
+
+	if out := e.run("", "/ask", "why", "is", "the", "sky", "blue"); out != "Rayleigh scattering.\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	if out := e.run("", "/ask", "-c", "what", "about", "Mars"); out != "Thin air scatters less light.\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+
+	// The follow up carries the whole conversation
+	requests := e.requests()
+	last := requests[len(requests)-1]
+	if !last.Stream || len(last.Messages) != 3 || last.Messages[1].Content != "Rayleigh scattering." {
+		t.Errorf("unexpected follow up request %+v", last)
+	}
+	if _, err := os.Stat(filepath.Join(e.dataDir, "sessions", "why-is-the-sky-blue.json")); err != nil {
+		t.Errorf("session not saved: %v", err)
+	}
+}
+
+const editResponse = "I'll change the greeting.\n\n" +
+	"```filepath=greet.go instruction=I'm changing the greeting\n" +
+	"// ... existing code ...\n" +
+	"\treturn \"hi\"\n" +
+	"// ... existing code ...\n" +
+	"```\n"
+
+const editFixtures = `
+- command: edit
+  response: |
+    I'll change the greeting.
+
+    ` + "```" + `filepath=greet.go instruction=I'm changing the greeting
+    // ... existing code ...
+    	return "hi"
+    // ... existing code ...
+    ` + "```" + `
+- command: apply
+  prompt: <instruction>.*I'm changing the greeting</instruction>
+  response: |
+    package main
+
+    func greet() string {
+    	return "hi"
+    }
+`
+
+func TestEditThenApply(t *testing.T) {
+	e := newEnv(t, editFixtures)
+
+	out := e.run("", "/edit", "greet.go", "say hi instead")
+	if !strings.Contains(out, "filepath=greet.go") {
+		t.Errorf("edit response not shown:\n%s", out)
+	}
+	if got := e.read(filepath.Join(e.dataDir, "last_edit_response.md")); got != editResponse {
+		t.Errorf("last edit response = %q", got)
+	}
+
+	// The file and the prompt both go to the model
+	edit := e.requests()[0]
+	if want := "```filepath=greet.go\npackage main\n"; !strings.HasPrefix(edit.Messages[0].Content, want) || !strings.HasSuffix(edit.Messages[0].Content, "say hi instead") {
+		t.Errorf("unexpected edit prompt %q", edit.Messages[0].Content)
+	}
+
+	out = e.run("", "/apply", "-y")
+	if !strings.Contains(out, "Applied edit to greet.go") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if got := e.read(filepath.Join(e.repo, "greet.go")); !strings.Contains(got, "return \"hi\"") {
+		t.Errorf("edit not applied:\n%s", got)
+	}
+}
+
+func TestApplyFromStdin(t *testing.T) {
+	e := newEnv(t, editFixtures)
+
+	out := e.run(editResponse, "/apply")
+	if !strings.Contains(out, "Successfully applied 1 edit(s)") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	apply := e.requests()[0]
+	if !strings.Contains(apply.Messages[0].Content, "<update>// ... existing code ...\n\treturn \"hi\"") {
+		t.Errorf("unexpected apply prompt %q", apply.Messages[0].Content)
+	}
+}
+
+func TestEditYolo(t *testing.T) {
+	e := newEnv(t, editFixtures)
+
+	out := e.run("", "/edit", "-y", "greet.go", "say hi instead")
+	if !strings.Contains(out, "Successfully applied 1 edit(s) in yolo mode") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if got := e.read(filepath.Join(e.repo, "greet.go")); !strings.Contains(got, "return \"hi\"") {
+		t.Errorf("edit not applied:\n%s", got)
+	}
+}
+
+func TestCommit(t *testing.T) {
+	e := newEnv(t, `
+- command: commit
+  response: "feat: Say hi instead of hello\n"
+`)
+
+	e.write(filepath.Join(e.repo, "greet.go"), "package main\n\nfunc greet() string {\n\treturn \"hi\"\n}\n")
+	e.run("", "/commit", "-y")
+
+	if got := e.git("log", "-1", "--format=%s"); got != "feat: Say hi instead of hello\n" {
+		t.Errorf("commit message = %q", got)
+	}
+	commit := e.requests()[0]
+	if !strings.Contains(commit.Messages[0].Content, "Initial commit") || !strings.Contains(commit.Messages[0].Content, "+\treturn \"hi\"") {
+		t.Errorf("commit prompt is missing the history or diff:\n%s", commit.Messages[0].Content)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	e := newEnv(t, `
+- model: test
+  response: '{"commands": [{"command": "ls", "explanation": "List"}], "message": ""}'
+- model: broken
+  response: '{"commands": [{"command": "ls -la", "explanation": "List all"}], "message": ""}'
+`)
+
+	out := e.run("", "/compare", "--cmd", "--pick", "2", "-M", "mock/test", "-M", "mock/broken", "list", "files")
+	if !strings.Contains(out, "=== [1] mock/test") || !strings.Contains(out, "=== [2] mock/broken") || !strings.Contains(out, "Kept the suggestions of mock/broken") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	if got := e.read(filepath.Join(e.dataDir, "expansions.txt")); got != "\nls -la" {
+		t.Errorf("expansions file = %q", got)
+	}
+	if requests := e.requests(); len(requests) != 2 || requests[0].Command != "compare" {
+		t.Errorf("unexpected requests %+v", requests)
+	}
+}
+
+func TestPromptTemplate(t *testing.T) {
+	e := newEnv(t, `
+- command: commit
+  response: "feat: Say hi"
+`)
+	e.write(filepath.Join(e.dataDir, "prompts", "commit.tmpl"), "{{.Default}}\n\nReference a JIRA key like PAL-123.")
+
+	e.write(filepath.Join(e.repo, "greet.go"), "package main\n")
+	e.run("", "/commit", "-y")
+	if system := e.requests()[0].System; !strings.HasPrefix(system, "You are a helpful assistant") || !strings.HasSuffix(system, "\n\nReference a JIRA key like PAL-123.") {
+		t.Errorf("template not used, system prompt is:\n%s", system)
+	}
+
+	if out := e.run("", "/prompts"); !strings.Contains(out, "commit  custom") || !strings.Contains(out, "cmd     default") {
+		t.Errorf("unexpected /prompts output:\n%s", out)
+	}
+	e.run("", "/prompts", "reset", "commit")
+	if _, err := os.Stat(filepath.Join(e.dataDir, "prompts", "commit.tmpl")); !os.IsNotExist(err) {
+		t.Errorf("template not removed by reset")
+	}
+}
+
+func TestCustomCommand(t *testing.T) {
+	e := newEnv(t, `
+- command: review
+  response: Looks good to me.
+- command: sh
+  response: '{"commands": [{"command": "tar xzf a.tgz", "explanation": "Extract"}], "message": ""}'
+`)
+	e.write(filepath.Join(e.dataDir, "config.yaml"), testConfig+`commands:
+  - name: review
+    description: Review a diff
+    prompt: "You review code on {{.OS}}. Be brief."
+    temperature: 0.3
+    stdin: true
+  - name: sh
+    key: sh
+    output: cmd
+  - name: ask
+    prompt: Shadows a built in command
+`)
+
+	out := e.run("+return \"hi\"", "/review", "anything", "wrong?")
+	if out != "Looks good to me.\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	e.run("", "/sh", "extract", "a.tgz")
+	if got := e.read(filepath.Join(e.dataDir, "expansions.txt")); got != "\ntar xzf a.tgz" {
+		t.Errorf("expansions file = %q", got)
+	}
+
+	requests := e.requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	review := requests[0]
+	if !strings.HasPrefix(review.System, "You review code on ") || review.Temperature != 0.3 || !strings.Contains(review.Messages[0].Content, "+return \"hi\"") {
+		t.Errorf("unexpected request %+v", review)
+	}
+	if sh := requests[1]; sh.Command != "sh" || sh.Schema == "" || sh.Temperature != 0 {
+		t.Errorf("unexpected request %+v", sh)
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	e := newEnv(t, `
+- response: Personal.
+`)
+	work := filepath.Join(e.dataDir, "profiles", "work")
+	e.write(filepath.Join(work, "config.yaml"), strings.Replace(testConfig, "models: [test, broken]", "models: [test, gateway]", 1)+`commands:
+  - name: standup
+    prompt: Summarize for a standup
+`)
+	e.write(filepath.Join(work, "fixtures.yaml"), "- response: Work.\n")
+
+	if out := e.run("", "/ask", "hi"); out != "Personal.\n" {
+		t.Errorf("default profile not used: %q", out)
+	}
+	if out := e.run("", "--profile", "work", "/ask", "hi"); out != "Work.\n" {
+		t.Errorf("--profile not used: %q", out)
+	}
+	// Custom commands come from the profile given with --profile
+	if out := e.run("", "--profile", "work", "/standup", "done"); out != "Work.\n" {
+		t.Errorf("custom command of the profile not run: %q", out)
+	}
+	if out := e.run("", "__complete", "--profile", "work", "/st"); !strings.Contains(out, "/standup") {
+		t.Errorf("custom command of the profile not completed:\n%s", out)
+	}
+	if out := e.run("", "__complete", "/st"); strings.Contains(out, "/standup") {
+		t.Errorf("custom command of another profile completed:\n%s", out)
+	}
+
+	e.run("", "/profile", "use", "work")
+	if out := e.run("", "/ask", "hi"); out != "Work.\n" {
+		t.Errorf("/profile use not used: %q", out)
+	}
+	// /model changes the config of the profile in use
+	e.run("", "/model", "mock/gateway")
+	if got := e.read(filepath.Join(work, "config.yaml")); !strings.Contains(got, "selected_model: mock/gateway") {
+		t.Errorf("model not selected in the work profile:\n%s", got)
+	}
+	if got := e.read(filepath.Join(e.dataDir, "config.yaml")); !strings.Contains(got, "selected_model: mock/test") {
+		t.Errorf("default profile changed:\n%s", got)
+	}
+
+	// PAL_PROFILE takes precedence over /profile use
+	e.vars = append(e.vars, "PAL_PROFILE=default")
+	if out := e.run("", "/ask", "hi"); out != "Personal.\n" {
+		t.Errorf("PAL_PROFILE not used: %q", out)
+	}
+	if out := e.run("", "/profile"); !strings.Contains(out, "* default\n  work\n") {
+		t.Errorf("unexpected /profile output:\n%s", out)
+	}
+}
+
+func TestProjectConfig(t *testing.T) {
+	e := newEnv(t, `
+- command: commit
+  model: broken
+  response: "PAL-1 Say hi"
+- command: edit
+  response: No changes.
+`)
+	e.write(filepath.Join(e.repo, ".pal.yaml"), `selected_models:
+  commit: mock/broken
+commit:
+  style: Start with the ticket, like PAL-1
+edit:
+  ignore: [gen/, "*.pb.go"]
+providers:
+  mock:
+    models: [evil]
+`)
+	e.write(filepath.Join(e.repo, "gen", "api.go"), "package gen\n")
+	e.write(filepath.Join(e.repo, "greet.pb.go"), "package main\n")
+	e.git("add", "-A")
+	e.git("commit", "-q", "-m", "Add project config")
+
+	e.write(filepath.Join(e.repo, "greet.go"), "package main\n")
+	e.run("", "/commit", "-y")
+	e.run("", "/edit", ".", "tidy up")
+
+	requests := e.requests()
+	if len(requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(requests))
+	}
+	if commit := requests[0]; commit.Model != "broken" || !strings.HasSuffix(commit.System, "Start with the ticket, like PAL-1") {
+		t.Errorf("project settings not used for /commit: %+v", commit)
+	}
+	edit := requests[1].Messages[0].Content
+	if !strings.Contains(edit, "filepath=greet.go") || strings.Contains(edit, "api.go") || strings.Contains(edit, "greet.pb.go") {
+		t.Errorf("ignored files were sent:\n%s", edit)
+	}
+
+	out := e.run("", "/config", "--show-effective")
+	project := filepath.Join(e.repo, ".pal.yaml")
+	for _, want := range []string{
+		"selected_model: mock/test # user config",
+		"commit: mock/broken # " + project,
+		"style: Start with the ticket, like PAL-1 # " + project,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "evil") {
+		t.Errorf("providers were taken from the project:\n%s", out)
+	}
+}
+
+func TestConfigCommands(t *testing.T) {
+	e := newEnv(t, "")
+	cfgPath := filepath.Join(e.dataDir, "config.yaml")
+
+	e.run("", "/config", "add-provider", "deepseek", "--key-env", "DEEPSEEK_API_KEY")
+	e.run("", "/config", "set", "selected_models.commit", "deepseek/deepseek-reasoner")
+	e.run("", "/config", "set", "fallback_models", "[deepseek/deepseek-chat]")
+	cfg := e.read(cfgPath)
+	for _, want := range []string{"api_key_env: DEEPSEEK_API_KEY", "commit: deepseek/deepseek-reasoner", "- deepseek/deepseek-chat", "selected_model: mock/test"} {
+		if !strings.Contains(cfg, want) {
+			t.Errorf("missing %q in config:\n%s", want, cfg)
+		}
+	}
+
+	var provider struct {
+		Models []string `json:"models"`
+	}
+	if err := json.Unmarshal([]byte(e.run("", "/config", "get", "providers.deepseek", "--json")), &provider); err != nil {
+		t.Fatal(err)
+	}
+	if len(provider.Models) != 2 || provider.Models[0] != "deepseek-chat" {
+		t.Errorf("unexpected models %v", provider.Models)
+	}
+	if got := e.run("", "/config", "get", "selected_model"); got != "mock/test\n" {
+		t.Errorf("get selected_model = %q", got)
+	}
+
+	// Invalid changes leave the config as it was
+	for _, args := range [][]string{
+		{"set", "selected_model", "nope/nope"},
+		{"set", "no_such_setting", "1"},
+		{"add-provider", "unknown"},
+		{"remove-provider", "deepseek"},
+	} {
+		cmd := exec.Command(palBinary, append([]string{"/config"}, args...)...)
+		cmd.Env = e.vars
+		if out, err := cmd.CombinedOutput(); err == nil {
+			t.Errorf("/config %s succeeded:\n%s", strings.Join(args, " "), out)
+		}
+	}
+	if got := e.read(cfgPath); got != cfg {
+		t.Errorf("config changed by invalid commands:\n%s", got)
+	}
+
+	e.run("", "/config", "set", "fallback_models", "[]")
+	e.run("", "/config", "set", "selected_models", "{}")
+	e.run("", "/config", "remove-provider", "deepseek")
+	if got := e.read(cfgPath); strings.Contains(got, "deepseek") {
+		t.Errorf("provider not removed:\n%s", got)
+	}
+}
+
+func TestDoctor(t *testing.T) {
+	e := newEnv(t, `
+- response: OK
+`)
+	// What the abbreviation scripts export when they're loaded
+	e.vars = append(e.vars, "PAL_ABBR_FILE="+filepath.Join(e.dataDir, "expansions.txt"), "PAL_ABBR_PREFIX=pal")
+
+	out := e.run("", "/doctor")
+	for _, want := range []string{"config               ok", "expansions file      ok", "shell abbreviations  ok", "provider mock        ok      test answered in"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+	if requests := e.requests(); len(requests) != 1 || requests[0].Command != "doctor" {
+		t.Errorf("unexpected requests %+v", requests)
+	}
+
+	e.write(filepath.Join(e.dataDir, "config.yaml"), strings.Replace(testConfig, "selected_model:", `  keyless:
+    url: http://127.0.0.1:1/v1/
+    api_key: ""
+    api_key_env: PAL_TEST_UNSET_KEY
+    models: [m]
+abbreviation_prefix: p
+selected_model:`, 1))
+	cmd := exec.Command(palBinary, "/doctor")
+	cmd.Env = e.vars
+	output, err := cmd.Output()
+	if err == nil {
+		t.Errorf("/doctor succeeded with failing checks")
+	}
+	out = string(output)
+	for _, want := range []string{
+		"shell abbreviations  warn",
+		"provider keyless     FAIL    Provider keyless takes its API key from $PAL_TEST_UNSET_KEY, which isn't set",
+		"- provider keyless: Fix the environment variable PAL_TEST_UNSET_KEY",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("missing %q in:\n%s", want, out)
+		}
+	}
+}
+
+func TestFallback(t *testing.T) {
+	e := newEnv(t, `
+- model: broken
+  status: 503
+- response: Still here.
+`)
+	e.write(filepath.Join(e.dataDir, "config.yaml"), strings.Replace(testConfig, "mock/test", "mock/broken", 1)+
+		"fallback_models: [mock/test]\nretry:\n  max_attempts: 1\n")
+
+	if out := e.run("", "/ask", "anyone", "there"); out != "Still here.\n" {
+		t.Errorf("unexpected output %q", out)
+	}
+	requests := e.requests()
+	if len(requests) != 2 || requests[0].Model != "broken" || requests[1].Model != "test" {
+		t.Errorf("unexpected requests %+v", requests)
+	}
+}
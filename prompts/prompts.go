@@ -0,0 +1,127 @@
+// Package prompts loads the user's own system prompts. A prompt template at
+// <config dir>/prompts/<command>.tmpl replaces the built in prompt for that
+// command. Templates use text/template, and can include the built in prompt
+// as {{.Default}}.
+package prompts
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"text/template"
+
+	"github.com/scottyeager/pal/config"
+)
+
+const promptDirName = "prompts"
+
+// Data is what templates can refer to
+type Data struct {
+	// The command key, like "cmd" or "commit"
+	Command string
+	// The operating system, as in runtime.GOOS
+	OS string
+	// The name of the user's shell, like "fish", from $SHELL
+	Shell string
+	// The current working directory
+	Cwd string
+	// The built in prompt
+	Default string
+}
+
+func Dir() (string, error) {
+	configDir, err := config.GetConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get config directory: %w", err)
+	}
+	return filepath.Join(configDir, promptDirName), nil
+}
+
+// Path returns where the template for command goes, whether or not it exists
+func Path(command string) (string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, command+".tmpl"), nil
+}
+
+// Exists reports whether the user has a template for command
+func Exists(command string) (bool, error) {
+	path, err := Path(command)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Render returns the system prompt for command. That's the user's template
+// if there is one, and otherwise defaultPrompt
+func Render(command string, defaultPrompt string) (string, error) {
+	path, err := Path(command)
+	if err != nil {
+		return "", err
+	}
+	text, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return defaultPrompt, nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read prompt template: %w", err)
+	}
+
+	prompt, err := Expand(string(text), NewData(command, defaultPrompt))
+	if err != nil {
+		return "", fmt.Errorf("error in prompt template %s: %w", path, err)
+	}
+	return prompt, nil
+}
+
+// Expand executes a prompt template
+func Expand(text string, data Data) (string, error) {
+	tmpl, err := template.New(data.Command).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+func NewData(command string, defaultPrompt string) Data {
+	cwd, _ := os.Getwd()
+	shell := os.Getenv("SHELL")
+	if shell != "" {
+		shell = filepath.Base(shell)
+	}
+	return Data{
+		Command: command,
+		OS:      runtime.GOOS,
+		Shell:   shell,
+		Cwd:     cwd,
+		Default: defaultPrompt,
+	}
+}
+
+// Reset removes the user's template for command, so the built in prompt is
+// used again
+func Reset(command string) error {
+	path, err := Path(command)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s already uses the built in prompt", command)
+	} else if err != nil {
+		return fmt.Errorf("failed to remove prompt template: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("SHELL", "/usr/bin/fish")
+
+	prompt, err := Render("cmd", "Suggest commands.")
+	if err != nil || prompt != "Suggest commands." {
+		t.Fatalf("without a template: got %q, %v", prompt, err)
+	}
+
+	path, err := Path("cmd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{{.Default}} We use {{.Shell}}."), 0644); err != nil {
+		t.Fatal(err)
+	}
+	prompt, err = Render("cmd", "Suggest commands.")
+	if err != nil || prompt != "Suggest commands. We use fish." {
+		t.Errorf("with a template: got %q, %v", prompt, err)
+	}
+
+	if err := os.WriteFile(path, []byte("{{.Nope}}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Render("cmd", ""); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("bad template: got %v, want an error naming the file", err)
+	}
+
+	if err := Reset("cmd"); err != nil {
+		t.Fatal(err)
+	}
+	if exists, _ := Exists("cmd"); exists {
+		t.Errorf("template still exists after reset")
+	}
+}
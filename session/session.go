@@ -0,0 +1,283 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/scottyeager/pal/ai"
+	"github.com/scottyeager/pal/config"
+	"github.com/scottyeager/pal/inout"
+)
+
+// Session is a saved /ask conversation that can be continued later
+type Session struct {
+	Name     string       `json:"name"`
+	Model    string       `json:"model"`
+	Created  time.Time    `json:"created"`
+	Updated  time.Time    `json:"updated"`
+	Messages []ai.Message `json:"messages"`
+}
+
+const sessionDirName = "sessions"
+
+// The name of the last used session is kept here, so it can be continued
+const lastSessionFileName = "last"
+
+func getSessionDir() (string, error) {
+	basePath, err := config.GetBasePath()
+	if err != nil {
+		return "", fmt.Errorf("failed to get base path: %w", err)
+	}
+	return filepath.Join(basePath, sessionDirName), nil
+}
+
+func getSessionPath(name string) (string, error) {
+	if err := validateName(name); err != nil {
+		return "", err
+	}
+	dir, err := getSessionDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+func validateName(name string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid session name '%s'. Use letters, numbers, dots, dashes and underscores", name)
+	}
+	return nil
+}
+
+// NameFor picks an unused session name based on the first question, so the
+// session is easy to recognize in the list
+func NameFor(question string) (string, error) {
+	base := slugify(question)
+	name := base
+	for i := 2; ; i++ {
+		exists, err := Exists(name)
+		if err != nil {
+			return "", err
+		}
+		if !exists {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+func New(name string, model string) (*Session, error) {
+	if err := validateName(name); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &Session{
+		Name:    name,
+		Model:   model,
+		Created: now,
+		Updated: now,
+	}, nil
+}
+
+func slugify(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	if len(words) > 6 {
+		words = words[:6]
+	}
+	slug := strings.Join(words, "-")
+	if slug == "" {
+		slug = time.Now().Format("2006-01-02-150405")
+	}
+	return slug
+}
+
+func Exists(name string) (bool, error) {
+	path, err := getSessionPath(name)
+	if err != nil {
+		return false, err
+	}
+	_, err = os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func Load(name string) (*Session, error) {
+	path, err := getSessionPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session '%s' not found. Run 'pal /sessions' to list sessions", name)
+		}
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse session '%s': %w", name, err)
+	}
+	s.Name = name
+	return &s, nil
+}
+
+// Save writes the session to disk and marks it as the last used session
+func Save(s *Session) error {
+	path, err := getSessionPath(s.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	s.Updated = time.Now()
+	// Attachments are kept by name and path. Their data was sent with the
+	// question they came with, and isn't sent again
+	saved := *s
+	saved.Messages = ai.WithoutAttachmentData(s.Messages)
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	if err := inout.WriteFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write session file: %w", err)
+	}
+
+	return SetLast(s.Name)
+}
+
+// List returns all sessions, most recently updated first
+func List() ([]*Session, error) {
+	dir, err := getSessionDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read session directory: %w", err)
+	}
+
+	var sessions []*Session
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok || entry.IsDir() {
+			continue
+		}
+		s, err := Load(name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Skipping session %s: %v\n", name, err)
+			continue
+		}
+		sessions = append(sessions, s)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].Updated.After(sessions[j].Updated)
+	})
+	return sessions, nil
+}
+
+func Rename(oldName string, newName string) error {
+	oldPath, err := getSessionPath(oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := getSessionPath(newName)
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(oldPath); os.IsNotExist(err) {
+		return fmt.Errorf("session '%s' not found", oldName)
+	}
+	if _, err := os.Stat(newPath); err == nil {
+		return fmt.Errorf("session '%s' already exists", newName)
+	}
+
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("failed to rename session: %w", err)
+	}
+
+	if last, _ := Last(); last == oldName {
+		return SetLast(newName)
+	}
+	return nil
+}
+
+func Delete(name string) error {
+	path, err := getSessionPath(name)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("session '%s' not found", name)
+		}
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+
+	if last, _ := Last(); last == name {
+		dir, err := getSessionDir()
+		if err != nil {
+			return err
+		}
+		os.Remove(filepath.Join(dir, lastSessionFileName))
+	}
+	return nil
+}
+
+// Last returns the name of the last used session, or an empty string if there
+// isn't one
+func Last() (string, error) {
+	dir, err := getSessionDir()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, lastSessionFileName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read last session: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func SetLast(name string) error {
+	dir, err := getSessionDir()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, lastSessionFileName), []byte(name+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write last session: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+// Package tools implements the read only tools that /ask offers the model, so
+// it can inspect the system instead of guessing
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/scottyeager/pal/ai"
+	"github.com/scottyeager/pal/config"
+)
+
+// Output beyond this many bytes is cut off, to keep requests a sane size
+const maxOutput = 32 * 1024
+
+const commandTimeout = 30 * time.Second
+
+// Runner runs tool calls from the model, after the user approves them
+type Runner struct {
+	commands    []string
+	autoApprove []string
+}
+
+func NewRunner(cfg config.Tools) *Runner {
+	commands := cfg.Commands
+	if len(commands) == 0 {
+		commands = config.DefaultToolCommands
+	}
+	return &Runner{commands: commands, autoApprove: cfg.AutoApprove}
+}
+
+func stringParam(description string) map[string]any {
+	return map[string]any{"type": "string", "description": description}
+}
+
+func params(name string, description string) map[string]any {
+	return map[string]any{
+		"type":                 "object",
+		"properties":           map[string]any{name: stringParam(description)},
+		"required":             []string{name},
+		"additionalProperties": false,
+	}
+}
+
+// Definitions describes the tools to the model
+func (r *Runner) Definitions() []ai.ToolDef {
+	return []ai.ToolDef{
+		{
+			Name:        "read_file",
+			Description: "Read a text file on the user's system",
+			Parameters:  params("path", "Path of the file. A leading ~ is the user's home directory"),
+		},
+		{
+			Name:        "list_directory",
+			Description: "List the contents of a directory on the user's system",
+			Parameters:  params("path", "Path of the directory. A leading ~ is the user's home directory"),
+		},
+		{
+			Name: "run_command",
+			Description: "Run a command on the user's system and get its output. Only these commands are allowed, with any arguments: " +
+				strings.Join(r.commands, ", ") + ". The command isn't run by a shell, so pipes, redirects and variables don't work",
+			Parameters: params("command", "The command line to run"),
+		},
+		{
+			Name:        "command_help",
+			Description: "Get the --help output of one of these programs: " + strings.Join(r.programs(), ", "),
+			Parameters:  params("program", "Name of the program"),
+		},
+	}
+}
+
+// Run carries out a tool call and returns the result for the model. A
+// transcript is written to stderr. Failures are returned as text too, so the
+// model can react to them.
+func (r *Runner) Run(ctx context.Context, call ai.ToolCall) string {
+	var args map[string]string
+	if err := json.Unmarshal([]byte(call.Arguments), &args); err != nil && call.Arguments != "" {
+		return fmt.Sprintf("Error: invalid arguments: %v", err)
+	}
+
+	var describe string
+	var run func() (string, error)
+	switch call.Name {
+	case "read_file":
+		describe = "read " + args["path"]
+		run = func() (string, error) { return readFile(args["path"]) }
+	case "list_directory":
+		describe = "list " + args["path"]
+		run = func() (string, error) { return listDirectory(args["path"]) }
+	case "run_command":
+		argv, err := splitCommand(args["command"])
+		if err != nil {
+			return "Error: " + err.Error()
+		}
+		if !r.allowed(argv) {
+			fmt.Fprintf(os.Stderr, "Tool call: run %s (not allowed)\n", args["command"])
+			if mutates(argv) {
+				return "Error: command not allowed, since it would change the system. Only read only commands can be run"
+			}
+			return fmt.Sprintf("Error: command not allowed. Allowed commands are: %s", strings.Join(r.commands, ", "))
+		}
+		describe = "run " + strings.Join(argv, " ")
+		run = func() (string, error) { return runCommand(ctx, argv) }
+	case "command_help":
+		program := args["program"]
+		if !slices.Contains(r.programs(), program) {
+			fmt.Fprintf(os.Stderr, "Tool call: run %s --help (not allowed)\n", program)
+			return fmt.Sprintf("Error: help is only available for the programs of the allowed commands: %s", strings.Join(r.programs(), ", "))
+		}
+		describe = "run " + program + " --help"
+		run = func() (string, error) { return runCommand(ctx, []string{program, "--help"}) }
+	default:
+		return fmt.Sprintf("Error: unknown tool %s", call.Name)
+	}
+
+	// Not every program knows --help, and some would just go ahead and do
+	// their usual thing, so command_help is always confirmed
+	if call.Name == "command_help" || !r.autoApproved(call.Name, args["command"]) {
+		approved, err := confirm(describe)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Tool call: %s (not approved: %v)\n", describe, err)
+			return "Error: the user couldn't be asked to approve this tool call"
+		}
+		if !approved {
+			return "The user declined this tool call"
+		}
+	} else {
+		fmt.Fprintf(os.Stderr, "Tool call: %s\n", describe)
+	}
+
+	output, err := run()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  failed: %v\n", err)
+		if output != "" {
+			return fmt.Sprintf("%s\nError: %v", output, err)
+		}
+		return "Error: " + err.Error()
+	}
+	fmt.Fprintf(os.Stderr, "  %d lines of output\n", strings.Count(strings.TrimRight(output, "\n"), "\n")+1)
+	return output
+}
+
+// mutatingFlags are flags that make otherwise read only programs change the
+// system, like cleaning up the journal. Commands with them are never allowed,
+// and neither are abbreviations of them, which getopt_long accepts
+var mutatingFlags = map[string][]string{
+	"journalctl": {"--vacuum-size", "--vacuum-time", "--vacuum-files", "--rotate", "--flush", "--sync", "--relinquish-var", "--smart-relinquish-var", "--setup-keys", "--update-catalog"},
+}
+
+// allowed checks argv against the allowed commands, word by word
+func (r *Runner) allowed(argv []string) bool {
+	if len(argv) == 0 || mutates(argv) {
+		return false
+	}
+	for _, command := range r.commands {
+		if hasPrefix(argv, strings.Fields(command)) {
+			return true
+		}
+	}
+	return false
+}
+
+func mutates(argv []string) bool {
+	flags := mutatingFlags[filepath.Base(argv[0])]
+	for _, arg := range argv[1:] {
+		name, _, _ := strings.Cut(arg, "=")
+		if len(name) <= 2 || !strings.HasPrefix(name, "--") {
+			continue
+		}
+		for _, flag := range flags {
+			if strings.HasPrefix(flag, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// programs returns the programs of the allowed commands, which command_help
+// can be used on
+func (r *Runner) programs() []string {
+	var programs []string
+	for _, command := range r.commands {
+		if fields := strings.Fields(command); len(fields) > 0 && !slices.Contains(programs, fields[0]) {
+			programs = append(programs, fields[0])
+		}
+	}
+	return programs
+}
+
+func (r *Runner) autoApproved(tool string, command string) bool {
+	argv, _ := splitCommand(command)
+	for _, entry := range r.autoApprove {
+		if entry == tool {
+			return true
+		}
+		if tool == "run_command" && len(argv) > 0 && hasPrefix(argv, strings.Fields(entry)) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasPrefix(argv []string, prefix []string) bool {
+	return len(prefix) > 0 && len(argv) >= len(prefix) && slices.Equal(argv[:len(prefix)], prefix)
+}
+
+// confirm asks the user on the terminal, since stdin may be piped input
+func confirm(describe string) (bool, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false, errors.New("no terminal")
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "Allow the model to %s? (y/N): ", describe)
+	answer, _ := bufio.NewReader(tty).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	return answer == "y" || answer == "Y", nil
+}
+
+// splitCommand splits a command line into arguments. Quotes are handled, but
+// anything that would need a shell is refused
+func splitCommand(command string) ([]string, error) {
+	if strings.ContainsAny(command, "|&;<>$`\\\n") {
+		return nil, errors.New("shell features like pipes, redirects and variables aren't supported")
+	}
+
+	var argv []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	for _, c := range command {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				current.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inArg = true
+		case c == ' ' || c == '\t':
+			if inArg {
+				argv = append(argv, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(c)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inArg {
+		argv = append(argv, current.String())
+	}
+	if len(argv) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return argv, nil
+}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+func readFile(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("no path given")
+	}
+	f, err := os.Open(expandHome(path))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxOutput+1))
+	if err != nil {
+		return "", err
+	}
+	return truncate(string(data)), nil
+}
+
+func listDirectory(path string) (string, error) {
+	if path == "" {
+		path = "."
+	}
+	entries, err := os.ReadDir(expandHome(path))
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for _, entry := range entries {
+		if entry.IsDir() {
+			fmt.Fprintf(&b, "%s/\n", entry.Name())
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.Mode().IsRegular() {
+			fmt.Fprintf(&b, "%s\t%d bytes\n", entry.Name(), info.Size())
+		} else {
+			fmt.Fprintf(&b, "%s\n", entry.Name())
+		}
+	}
+	if b.Len() == 0 {
+		return "(empty directory)", nil
+	}
+	return truncate(b.String()), nil
+}
+
+func runCommand(ctx context.Context, argv []string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	// Output goes to the model, never to a pager
+	cmd.Env = append(os.Environ(), "PAGER=cat", "SYSTEMD_PAGER=", "SYSTEMD_COLORS=0")
+	// Programs started by the command could keep its output open after it's
+	// killed
+	cmd.WaitDelay = time.Second
+	// Stop commands that print endlessly, like journalctl -f, as soon as
+	// there's enough output
+	output := &cappedBuffer{limit: maxOutput + 1, full: cancel}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	err := cmd.Run()
+	if output.Len() >= output.limit {
+		err = nil
+	}
+	return truncate(output.String()), err
+}
+
+// cappedBuffer keeps the first limit bytes written to it, and calls full
+// once it has them
+type cappedBuffer struct {
+	strings.Builder
+	limit int
+	full  func()
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Builder.Write(p[:min(len(p), room)])
+		if len(p) >= room {
+			b.full()
+		}
+	}
+	return len(p), nil
+}
+
+func truncate(output string) string {
+	if len(output) > maxOutput {
+		return output[:maxOutput] + "\n(output truncated)"
+	}
+	return output
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/scottyeager/pal/ai"
+	"github.com/scottyeager/pal/config"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command  string
+		expected []string
+		wantErr  bool
+	}{
+		{command: "systemctl status nginx", expected: []string{"systemctl", "status", "nginx"}},
+		{command: `journalctl -u "my service"  -n 50`, expected: []string{"journalctl", "-u", "my service", "-n", "50"}},
+		{command: "ls ''", expected: []string{"ls", ""}},
+		{command: "cat /etc/passwd | mail me", wantErr: true},
+		{command: "ls; rm -rf ~", wantErr: true},
+		{command: "cat $HOME/.ssh/id_rsa", wantErr: true},
+		{command: "ls `rm x`", wantErr: true},
+		{command: `cat "unterminated`, wantErr: true},
+		{command: "  ", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			argv, err := splitCommand(tt.command)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitCommand(%q) error = %v, wantErr %v", tt.command, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(argv, tt.expected) {
+				t.Errorf("splitCommand(%q) = %q, want %q", tt.command, argv, tt.expected)
+			}
+		})
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	r := NewRunner(config.Tools{AutoApprove: []string{"read_file", "systemctl status"}})
+
+	tests := []struct {
+		argv    []string
+		allowed bool
+	}{
+		{[]string{"systemctl", "status", "nginx"}, true},
+		{[]string{"systemctl", "restart", "nginx"}, false},
+		{[]string{"systemctl"}, false},
+		{[]string{"journalctl", "-u", "nginx"}, true},
+		{[]string{"journalctl", "--vacuum-time=1s"}, false},
+		{[]string{"journalctl", "-u", "nginx", "--rotate"}, false},
+		{[]string{"journalctl", "--flush"}, false},
+		{[]string{"journalctl", "--vacuum-t=1s"}, false},
+		{[]string{"journalctl", "--rot"}, false},
+		{[]string{"journalctl", "--flu"}, false},
+		{[]string{"journalctl", "--since", "today", "--no-pager"}, true},
+		{[]string{"lsblk"}, false},
+		{[]string{"rm", "-rf", "/"}, false},
+	}
+	for _, tt := range tests {
+		if got := r.allowed(tt.argv); got != tt.allowed {
+			t.Errorf("allowed(%q) = %v, want %v", tt.argv, got, tt.allowed)
+		}
+	}
+
+	if !r.autoApproved("read_file", "") {
+		t.Error("read_file should be auto approved")
+	}
+	if r.autoApproved("list_directory", "") {
+		t.Error("list_directory shouldn't be auto approved")
+	}
+	if !r.autoApproved("run_command", "systemctl status sshd") {
+		t.Error("systemctl status should be auto approved")
+	}
+	if r.autoApproved("run_command", "journalctl -u sshd") {
+		t.Error("journalctl shouldn't be auto approved")
+	}
+}
+
+func TestCommandHelpAllowlist(t *testing.T) {
+	r := NewRunner(config.Tools{AutoApprove: []string{"command_help"}})
+
+	for _, program := range []string{"rm", "shutdown", "/usr/bin/cat", ""} {
+		call := ai.ToolCall{Name: "command_help", Arguments: fmt.Sprintf(`{"program": %q}`, program)}
+		if got := r.Run(context.Background(), call); !strings.HasPrefix(got, "Error: help is only available") {
+			t.Errorf("command_help for %q wasn't refused: %q", program, got)
+		}
+	}
+}
+
+func TestRunCommandOutputLimit(t *testing.T) {
+	start := time.Now()
+	output, err := runCommand(context.Background(), []string{"yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("endless output wasn't stopped at the limit")
+	}
+	if !strings.HasSuffix(output, "(output truncated)") || len(output) > maxOutput+100 {
+		t.Errorf("got %d bytes of output, ending in %q", len(output), output[len(output)-30:])
+	}
+}